@@ -20,10 +20,11 @@ import (
 	"github.com/kitt1987/docker-papa/pkg/image"
 	"github.com/spf13/cobra"
 	"os"
+	"os/exec"
+	"strings"
+	"time"
 )
 
-// FIXME a command to show or purge legacy history
-
 // containerCmd represents the container command
 var containerCmd = &cobra.Command{
 	Use:   "container",
@@ -31,10 +32,78 @@ var containerCmd = &cobra.Command{
 	Long: `Recreate a container with the same arguments except a new image.
 	docker-papa container -r turtle --image registry.cloudtogo.cn/cloudtogo.cn/official/turtle:1.7.0-build-create-new-cluster-20190520141436
 
+	Recreate a container and get the original one back if the new one fails its healthcheck.
+	docker-papa container -r turtle --image turtle:1.7.1 --wait-healthy
+
+	Show what would be changed by a recreation without touching the container.
+	docker-papa container -r turtle --image turtle:1.7.1 --dry-run
+
 	Show a docker command line could run the same container.
-	docker-papa container -c turtle`,
-	Args: cobra.ExactArgs(1),
+	docker-papa container -c turtle
+
+	Get the legacy container back after recreating.
+	docker-papa container --recover turtle
+
+	Roll a container back to the spec recorded before its latest recreation, or the one at a time.
+	docker-papa container --rollback turtle --to -1
+	docker-papa container --rollback turtle --to "2019-05-20 14:00:00"
+
+	Recreate all containers using an image, 2 at a time.
+	docker-papa container -r --all-using-image turtle:1.7.0 --image turtle:1.7.1 --parallelism 2
+
+	Recreate all containers with a label.
+	docker-papa container -r --filter label=app=turtle --image turtle:1.7.1
+
+	Export containers as services of a docker-compose.yml.
+	docker-papa container --export compose turtle rabbit > docker-compose.yml
+
+	Export a container as a Kubernetes Deployment and Service.
+	docker-papa container --export kubernetes turtle > turtle.yaml
+
+	Export a container as a systemd service unit.
+	docker-papa container --export systemd turtle > /etc/systemd/system/turtle.service
+
+	Rolling update containers one by one, waiting 30 seconds between two of them.
+	docker-papa container -r --rolling turtle-1 turtle-2 turtle-3 --image turtle:1.7.1 --rolling-delay 30s`,
+	Args: cobra.ArbitraryArgs,
 	Run: func(_ *cobra.Command, containerArgs []string) {
+		if len(args.export) > 0 {
+			if err := exportContainers(containerArgs); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				os.Exit(2)
+			}
+
+			return
+		}
+
+		if actions.Recreate && args.rolling {
+			if err := rollContainers(containerArgs); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				os.Exit(2)
+			}
+
+			return
+		}
+
+		if actions.Recreate && args.isBatch() {
+			if len(containerArgs) > 0 {
+				fmt.Fprintf(os.Stderr, "container name can't be used with --all-using-image or --filter\n")
+				os.Exit(2)
+			}
+
+			if err := recreateContainers(); err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				os.Exit(2)
+			}
+
+			return
+		}
+
+		if len(containerArgs) != 1 {
+			fmt.Fprintf(os.Stderr, "exactly 1 container name or ID is required\n")
+			os.Exit(2)
+		}
+
 		args.nameOrID = containerArgs[0]
 		if actions.Recreate {
 			if err := recreateContainer(); err != nil {
@@ -43,6 +112,21 @@ var containerCmd = &cobra.Command{
 			}
 		}
 
+		if actions.Rollback {
+			if err := rollbackContainer(); err != nil {
+				fmt.Fprintf(os.Stderr, "container %s : %s\n", args.nameOrID, err)
+				os.Exit(2)
+			}
+		}
+
+		if actions.Recover {
+			if err := container.RecoverLegacyContainer(args.nameOrID, dockerDaemonSocket,
+				recreateOpts.KeepFiles); err != nil {
+				fmt.Fprintf(os.Stderr, "container %s : %s\n", args.nameOrID, err)
+				os.Exit(2)
+			}
+		}
+
 		if actions.Parse {
 			if cmd, err := parseContainer(); err != nil {
 				fmt.Fprintf(os.Stderr, "container %s : %s\n", args.nameOrID, err)
@@ -57,17 +141,30 @@ var containerCmd = &cobra.Command{
 type containerActions struct {
 	Recreate bool
 	Parse    bool
-	Recover bool //Get a legacy container back
+	Recover  bool //Get a legacy container back
+	Rollback bool
 }
 
 type containerArgs struct {
-	nameOrID   string
+	nameOrID      string
+	allUsingImage string
+	filters       []string
+	parallelism   int
+	rolling       bool
+	rollingOpts   container.RollingOptions
+	export        string
+	rollbackTo    string
+}
+
+func (a containerArgs) isBatch() bool {
+	return len(a.allUsingImage) > 0 || len(a.filters) > 0
 }
 
 var (
 	actions      containerActions
 	args         containerArgs
 	recreateOpts container.RecreateOptions
+	cmdOpts      container.CommandOptions
 	cmd          string
 )
 
@@ -103,12 +200,45 @@ func init() {
 		"Drop all commands of the container")
 	containerCmd.Flags().StringVar(&recreateOpts.Rename, "rename", "", "New name of the container")
 	containerCmd.Flags().StringSliceVar(&recreateOpts.KeepFiles, "keep-file", recreateOpts.KeepFiles,
-		"Keep files or directories after recreating")
+		"Keep files or directories after recreating or recovering")
 	containerCmd.Flags().BoolVarP(&actions.Recreate, "recreate", "r", false,
-		"Recreate a existed docker container with specified options. The current container will be renamed to" +
-		"its original name with a suffix .legacy and stopped.")
+		"Recreate a existed docker container with specified options. The current container will be renamed to "+
+			"its original name with a suffix .legacy and stopped.")
+	containerCmd.Flags().BoolVar(&actions.Recover, "recover", false,
+		"Remove the container and get its legacy container back")
+	containerCmd.Flags().BoolVar(&actions.Rollback, "rollback", false,
+		"Recreate the container as it was recorded in the recreate history. See --to")
+	containerCmd.Flags().StringVar(&args.rollbackTo, "to", "",
+		"The history record to roll back to, an index shown by \"docker-papa history list\" where negative ones "+
+			"count from the latest, or a time like \"2019-05-20 14:00:00\" before which the latest record is used")
+	containerCmd.Flags().BoolVar(&recreateOpts.DryRun, "dry-run", false,
+		"Print differences between the current container and the recreated one without changing anything")
+	containerCmd.Flags().BoolVar(&recreateOpts.WaitHealthy, "wait-healthy", false,
+		"Wait for the new container to become healthy, or keep running in the grace period if no healthcheck "+
+			"defined. The original container will be restored if the new one fails")
+	containerCmd.Flags().DurationVar(&recreateOpts.HealthTimeout, "health-timeout", 2*time.Minute,
+		"How long to wait for the new container to become healthy")
+	containerCmd.Flags().DurationVar(&recreateOpts.GracePeriod, "grace-period", 10*time.Second,
+		"How long the new container should keep running if no healthcheck defined")
+	containerCmd.Flags().StringVar(&args.allUsingImage, "all-using-image", "",
+		"Recreate all containers using the image")
+	containerCmd.Flags().StringSliceVar(&args.filters, "filter", args.filters,
+		"Recreate all containers matching the filter, e.g. label=app=turtle")
+	containerCmd.Flags().IntVar(&args.parallelism, "parallelism", 1,
+		"How many containers could be recreated at the same time in batch")
+	containerCmd.Flags().BoolVar(&args.rolling, "rolling", false,
+		"Recreate containers specified by names or filters in a rolling fashion. Each new container must be "+
+			"healthy before the next one is recreated and the rollout halts on the first failure")
+	containerCmd.Flags().IntVar(&args.rollingOpts.MaxUnavailable, "max-unavailable", 1,
+		"How many containers could be recreated at the same time in a rolling update")
+	containerCmd.Flags().DurationVar(&args.rollingOpts.Delay, "rolling-delay", 0,
+		"How long to wait after a container is recreated in a rolling update")
 	containerCmd.Flags().BoolVarP(&actions.Parse, "parse", "c", false,
 		"Generate docker run command line from a existed container")
+	containerCmd.Flags().StringVar(&args.export, "export", "",
+		"Export containers in another format, compose, kubernetes or systemd")
+	containerCmd.Flags().BoolVar(&cmdOpts.Multiline, "multiline", false,
+		"Break the generated command line into multiple lines")
 }
 
 func recreateContainer() (err error) {
@@ -117,34 +247,242 @@ func recreateContainer() (err error) {
 		return
 	}
 
+	// Containers are only recreated with new images.
+	if len(recreateOpts.Image) == 0 {
+		if recreateOpts.DryRun {
+			fmt.Fprintf(os.Stdout, "No changes to container %s since --image is not given\n", c.Name())
+		}
+
+		return
+	}
+
+	// Nothing on the daemon should be changed in dry-run mode, including images.
+	if !recreateOpts.DryRun {
+		pullImageIfNotExists(recreateOpts.Image)
+	}
+
+	if len(cmd) > 0 {
+		recreateOpts.Cmd = splitCliArgs(cmd)
+	}
+
+	_, err = c.Recreate(&recreateOpts)
+	return
+}
+
+func rollbackContainer() (err error) {
+	if len(args.rollbackTo) == 0 {
+		return fmt.Errorf("--to is required to roll back")
+	}
+
+	c, err := container.GetExistedDockerContainer(args.nameOrID, dockerDaemonSocket)
+	if err != nil {
+		return
+	}
+
+	f, err := openHistory()
+	if err != nil {
+		return
+	}
+
+	// The history must be released before recreating, which logs in it too.
+	records, err := containerHistoryRecords(f, c.Name())
+	f.Close()
+	if err != nil {
+		return
+	}
+
+	record, err := historyRecordAt(records, args.rollbackTo)
+	if err != nil {
+		return
+	}
+
+	if recreateOpts.Spec, err = container.RollbackSpec(&record.entry); err != nil {
+		err = fmt.Errorf("fail to roll back to record #%d cuz %s", record.Index, err)
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, "Roll back to record #%d recorded at %s\n", record.Index,
+		record.Time.Local().Format(historyTimeFormat))
+
+	image := recreateOpts.Spec.Config.Image
 	if len(recreateOpts.Image) > 0 {
-		if found, err := image.ExistsLocally(recreateOpts.Image); err != nil || !found {
-			if err = image.DockerPull(recreateOpts.Image); err != nil {
-				fmt.Fprintf(os.Stderr, "can't pull image %s:%s. use local images instead.\n",
-					recreateOpts.Image, err)
+		image = recreateOpts.Image
+	}
+
+	if !recreateOpts.DryRun {
+		pullImageIfNotExists(image)
+	}
+
+	if len(cmd) > 0 {
+		recreateOpts.Cmd = splitCliArgs(cmd)
+	}
+
+	_, err = c.Recreate(&recreateOpts)
+	return
+}
+
+func recreateContainers() (err error) {
+	containers, err := selectContainers(nil)
+	if err != nil {
+		return
+	}
+
+	results := container.RecreateAll(containers, &recreateOpts, args.parallelism)
+	container.PrintRecreateResults(os.Stdout, results)
+	return checkRecreateResults(results)
+}
+
+func rollContainers(names []string) (err error) {
+	if len(names) > 0 && args.isBatch() {
+		return fmt.Errorf("container names can't be used with --all-using-image or --filter")
+	}
+
+	containers, err := selectContainers(names)
+	if err != nil {
+		return
+	}
+
+	results := container.RollingRecreate(containers, &recreateOpts, &args.rollingOpts)
+	container.PrintRecreateResults(os.Stdout, results)
+	return checkRecreateResults(results)
+}
+
+// selectContainers returns containers specified by names, or by filters if no name given. It also prepares
+// options of recreating multiple containers.
+func selectContainers(names []string) (containers []container.DockerContainer, err error) {
+	if len(recreateOpts.Image) == 0 {
+		err = fmt.Errorf("--image is required to recreate multiple containers")
+		return
+	}
+
+	if len(recreateOpts.Rename) > 0 {
+		err = fmt.Errorf("multiple containers can't be renamed")
+		return
+	}
+
+	if len(names) > 0 {
+		for _, name := range names {
+			var c container.DockerContainer
+			if c, err = container.GetExistedDockerContainer(name, dockerDaemonSocket); err != nil {
+				err = fmt.Errorf("container %s : %s", name, err)
+				return
 			}
-		} else {
-			fmt.Fprintf(os.Stdout, "Found image %s locally\n", recreateOpts.Image)
-		}
 
-		if len(cmd) > 0 {
-			recreateOpts.Cmd = splitCliArgs(cmd)
+			containers = append(containers, c)
+		}
+	} else {
+		filters := append([]string{}, args.filters...)
+		if len(args.allUsingImage) > 0 {
+			filters = append(filters, "ancestor="+args.allUsingImage)
 		}
 
-		if _, err = c.Recreate(&recreateOpts); err != nil {
+		if containers, err = container.ListExistedDockerContainers(filters, dockerDaemonSocket); err != nil {
 			return
 		}
 	}
 
+	if !recreateOpts.DryRun {
+		pullImageIfNotExists(recreateOpts.Image)
+	}
+
+	if len(cmd) > 0 {
+		recreateOpts.Cmd = splitCliArgs(cmd)
+	}
+
 	return
 }
 
+func checkRecreateResults(results []container.RecreateResult) error {
+	for _, r := range results {
+		if r.Err != nil {
+			return fmt.Errorf("fail to recreate all containers")
+		}
+	}
+
+	return nil
+}
+
+func exportContainers(names []string) (err error) {
+	if len(names) == 0 {
+		return fmt.Errorf("at least 1 container name or ID is required")
+	}
+
+	var containers []container.DockerContainer
+	for _, name := range names {
+		var c container.DockerContainer
+		if c, err = container.GetExistedDockerContainer(name, dockerDaemonSocket); err != nil {
+			return fmt.Errorf("container %s : %s", name, err)
+		}
+
+		containers = append(containers, c)
+	}
+
+	switch strings.ToLower(args.export) {
+	case "compose":
+		var f *container.ComposeFile
+		if f, err = container.NewComposeFile(containers); err != nil {
+			return
+		}
+
+		return f.Write(os.Stdout)
+	case "kubernetes", "k8s":
+		var manifests []interface{}
+		for _, c := range containers {
+			m, warnings, err := c.ConvertToKubernetesManifests()
+			if err != nil {
+				return fmt.Errorf("container %s : %s", c.Name(), err)
+			}
+
+			for _, w := range warnings {
+				fmt.Fprintf(os.Stderr, "WARNING: container %s : %s\n", c.Name(), w)
+			}
+
+			manifests = append(manifests, m...)
+		}
+
+		return container.WriteKubernetesManifests(os.Stdout, manifests)
+	case "systemd":
+		if len(containers) != 1 {
+			return fmt.Errorf("only 1 container could be exported as a systemd unit")
+		}
+
+		opts := &container.SystemdOptions{
+			Host:      dockerDaemonSocket,
+			Multiline: cmdOpts.Multiline,
+		}
+
+		if dockerPath, err := exec.LookPath("docker"); err == nil {
+			opts.Docker = dockerPath
+		}
+
+		unit, err := containers[0].ConvertToSystemdUnit(opts)
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(unit)
+		return nil
+	default:
+		return fmt.Errorf("unsupported export format %s", args.export)
+	}
+}
+
+func pullImageIfNotExists(ref string) {
+	if found, err := image.ExistsLocally(ref, dockerDaemonSocket); err != nil || !found {
+		if err = image.DockerPull(ref, dockerDaemonSocket); err != nil {
+			fmt.Fprintf(os.Stderr, "can't pull image %s:%s. use local images instead.\n", ref, err)
+		}
+	} else {
+		fmt.Fprintf(os.Stdout, "Found image %s locally\n", ref)
+	}
+}
+
 func parseContainer() (cmd string, err error) {
 	c, err := container.GetExistedDockerContainer(args.nameOrID, dockerDaemonSocket)
 	if err != nil {
 		return
 	}
 
-	cmd, err = c.ConvertToDockerCommand()
+	cmd, err = c.ConvertToDockerCommand(&cmdOpts)
 	return
 }
@@ -15,10 +15,14 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"github.com/kitt1987/docker-papa/pkg/ctx"
+	"github.com/kitt1987/docker-papa/pkg/daemon"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"gopkg.in/yaml.v2"
+	"io"
 	"os"
 	"strings"
 )
@@ -32,9 +36,38 @@ var contextCmd = &cobra.Command{
 Samples:
   Create a new context,
   docker-papa context create uat --registry registry-bj.uat.abc.cn
+
+  Create a context which connects to a remote daemon as well,
+  docker-papa context create prod-3 --registry registry-bj.abc.cn --docker-host ssh://ops@prod-3.abc.cn
   
+  Create a context with credentials of the registry. Credentials in ~/.docker/config.json are used if not given,
+  echo "$REGISTRY_PASSWORD" | docker-papa context create uat --registry registry-bj.uat.abc.cn --username ci \
+    --password-stdin
+
+  Create a context with a registry serving plain HTTP,
+  docker-papa context create dev --registry registry.dev.abc.cn:5000 --insecure-registry
+
   Switch to another context,
-  docker-papa context switch uat`,
+  docker-papa context switch uat
+
+  Switch to another context only in the current shell. Set "context-mode: multi-user" in ~/.docker-papa.yaml to
+  make it the default, or set PAPA_CONTEXT to use a context in a command,
+  docker-papa context switch uat --shell
+  PAPA_CONTEXT=uat docker-papa push registry.context/app:1.0
+
+  Show the current context in the prompt of bash, zsh or fish,
+  eval "$(docker-papa context prompt --init bash)"
+
+  List all contexts,
+  docker-papa context list -o yaml
+
+  Share a context with others, who import it with another name. The TLS CA certificate of the daemon is embedded,
+  docker-papa context export prod-3 > prod-3.yaml
+  docker-papa context import prod-3.yaml --name prod
+
+  Remove contexts, the current one can't be removed unless --force,
+  docker-papa context purge uat
+  docker-papa context purge --all`,
 	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		action := strings.ToLower(args[0])
@@ -54,9 +87,30 @@ Samples:
 			}
 
 			c := ctx.Context{
-				Name:         args[0],
-				Registry:     ctxArgs.registry,
-				RegistryName: ctxArgs.registryName,
+				Name:             args[0],
+				Registry:         ctxArgs.registry,
+				RegistryName:     ctxArgs.registryName,
+				InsecureRegistry: ctxArgs.insecureRegistry,
+			}
+
+			if ctxArgs.daemon != (ctx.Daemon{}) {
+				d := ctxArgs.daemon
+				c.Daemon = &d
+			}
+
+			if ctxArgs.passwordStdin != (len(ctxArgs.credentials.Username) > 0) {
+				fmt.Fprintf(os.Stderr, "--username and --password-stdin must be given together\n")
+				os.Exit(2)
+			}
+
+			if ctxArgs.passwordStdin {
+				password, err := readPassword(os.Stdin)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "read password failed: %s\n", err)
+					os.Exit(2)
+				}
+
+				c.Credentials = &ctx.Credentials{Username: ctxArgs.credentials.Username, Password: password}
 			}
 
 			err := ctx.Create(&c)
@@ -65,14 +119,11 @@ Samples:
 				os.Exit(2)
 			}
 
-			err = ctx.Switch(&c, ctx.SingleUserContext)
-			if err != nil {
+			if err = switchContext(&c); err != nil {
 				fmt.Fprintf(os.Stderr, "switch context failed: %s\n", err)
 				os.Exit(2)
 			}
 
-			fmt.Printf("context %s is used\n", c.Name)
-
 		case "switch":
 			if len(args) == 0 || len(args[0]) == 0 {
 				fmt.Fprintf(os.Stderr, "context name is required\n")
@@ -85,16 +136,74 @@ Samples:
 				os.Exit(2)
 			}
 
-			err = ctx.Switch(c, ctx.SingleUserContext)
-			if err != nil {
+			if err = switchContext(c); err != nil {
 				fmt.Fprintf(os.Stderr, "switch context failed: %s\n", err)
 				os.Exit(2)
 			}
 
-			fmt.Printf("context %s is used\n", c.Name)
-
 		case "list":
+			if err := listContexts(); err != nil {
+				fmt.Fprintf(os.Stderr, "list contexts failed: %s\n", err)
+				os.Exit(2)
+			}
+
 		case "purge":
+			if len(args) == 0 && !ctxArgs.all {
+				fmt.Fprintf(os.Stderr, "context names or --all is required\n")
+				os.Exit(2)
+			}
+
+			if len(args) > 0 && ctxArgs.all {
+				fmt.Fprintf(os.Stderr, "context names can't be used with --all\n")
+				os.Exit(2)
+			}
+
+			if err := purgeContexts(args); err != nil {
+				fmt.Fprintf(os.Stderr, "purge contexts failed: %s\n", err)
+				os.Exit(2)
+			}
+
+		case "prompt":
+			if len(ctxArgs.promptInit) > 0 {
+				snippet, found := promptSnippets[ctxArgs.promptInit]
+				if !found {
+					fmt.Fprintf(os.Stderr, "only bash, zsh and fish are supported\n")
+					os.Exit(2)
+				}
+
+				fmt.Print(snippet)
+				return
+			}
+
+			if name := currentContextName(); len(name) > 0 {
+				fmt.Printf("(papa:%s) ", name)
+			}
+
+		case "export":
+			if len(args) == 0 || len(args[0]) == 0 {
+				fmt.Fprintf(os.Stderr, "context name is required\n")
+				os.Exit(2)
+			}
+
+			if err := ctx.Export(args[0], os.Stdout, ctxArgs.includeSecrets); err != nil {
+				fmt.Fprintf(os.Stderr, "export context %s failed: %s\n", args[0], err)
+				os.Exit(2)
+			}
+
+		case "import":
+			if len(args) == 0 || len(args[0]) == 0 {
+				fmt.Fprintf(os.Stderr, "a context file or - is required\n")
+				os.Exit(2)
+			}
+
+			c, err := importContext(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "import context failed: %s\n", err)
+				os.Exit(2)
+			}
+
+			fmt.Printf("context %s is imported\n", c.Name)
+
 		case "current":
 			c, err := ctx.Current()
 			if err != nil {
@@ -102,6 +211,10 @@ Samples:
 				os.Exit(2)
 			}
 
+			if c != nil && c.Credentials != nil {
+				c.Credentials = &ctx.Credentials{Username: c.Credentials.Username}
+			}
+
 			yaml.NewEncoder(os.Stdout).Encode(c)
 
 		default:
@@ -110,22 +223,192 @@ Samples:
 	},
 }
 
-type contextActions struct {
-	Create bool
-	List   bool
-	Purge  bool
-}
-
 type contextArgs struct {
 	name         string
 	registryName string
 	registry     string
+	all          bool
+	force        bool
+	output       string
+	daemon       ctx.Daemon
+	credentials  ctx.Credentials
+	// passwordStdin reads the registry password from stdin, so that it is not left in the shell history.
+	passwordStdin    bool
+	insecureRegistry bool
+	shell            bool
+	global           bool
+	promptInit       string
+	includeSecrets   bool
 }
 
-var (
-	ctxActions contextActions
-	ctxArgs    contextArgs
-)
+var ctxArgs contextArgs
+
+type contextItem struct {
+	Name         string `json:"name" yaml:"name"`
+	Registry     string `json:"registry" yaml:"registry"`
+	RegistryName string `json:"registryName" yaml:"registryName"`
+	Daemon       string `json:"daemon,omitempty" yaml:"daemon,omitempty"`
+	Current      bool   `json:"current" yaml:"current"`
+}
+
+// promptSnippets are shell scripts which prepend the current context to the prompt.
+var promptSnippets = map[string]string{
+	"bash": `PS1='$(docker-papa context prompt 2>/dev/null)'"$PS1"
+`,
+	"zsh": `setopt PROMPT_SUBST
+PROMPT='$(docker-papa context prompt 2>/dev/null)'"$PROMPT"
+`,
+	"fish": `functions -c fish_prompt __papa_fish_prompt
+function fish_prompt
+    docker-papa context prompt 2>/dev/null
+    __papa_fish_prompt
+end
+`,
+}
+
+// switchContext makes the context current in the shell or for the user. The mode is decided by --shell, --global
+// or the config context-mode.
+func switchContext(c *ctx.Context) (err error) {
+	mode := ctx.SingleUserContext
+	if ctxArgs.shell || (!ctxArgs.global &&
+		ctx.ContextMode(viper.GetString(contextModeConfig)) == ctx.MultipleUserContext) {
+		mode = ctx.MultipleUserContext
+	}
+
+	if err = ctx.Switch(c, mode); err != nil {
+		return
+	}
+
+	if mode == ctx.MultipleUserContext {
+		fmt.Printf("context %s is used in the current shell\n", c.Name)
+	} else {
+		fmt.Printf("context %s is used\n", c.Name)
+	}
+
+	if name := os.Getenv(ctx.ContextEnv); len(name) > 0 {
+		fmt.Fprintf(os.Stderr, "context %s is still used since %s is set\n", name, ctx.ContextEnv)
+	}
+
+	return
+}
+
+// importContext imports a context from the file, or stdin if the file is -.
+func importContext(file string) (c *ctx.Context, err error) {
+	r := io.Reader(os.Stdin)
+	if file != "-" {
+		var f *os.File
+		if f, err = os.Open(file); err != nil {
+			return
+		}
+
+		defer f.Close()
+		r = f
+	}
+
+	return ctx.Import(r, ctxArgs.name, ctxArgs.force)
+}
+
+// readPassword reads the password in the first line of r.
+func readPassword(r io.Reader) (password string, err error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return
+	}
+
+	password = strings.TrimRight(line, "\r\n")
+	if len(password) == 0 {
+		err = fmt.Errorf("empty password")
+		return
+	}
+
+	return password, nil
+}
+
+// currentContextName returns the name of the current context, or an empty string if no context is used.
+func currentContextName() string {
+	if c, err := ctx.Current(); err == nil && c != nil {
+		return c.Name
+	}
+
+	return ""
+}
+
+func listContexts() (err error) {
+	contexts, err := ctx.List()
+	if err != nil {
+		return
+	}
+
+	current := currentContextName()
+	items := make([]contextItem, 0, len(contexts))
+	for _, c := range contexts {
+		item := contextItem{
+			Name:         c.Name,
+			Registry:     c.Registry,
+			RegistryName: c.RegistryName,
+			Current:      c.Name == current,
+		}
+
+		if c.Daemon != nil {
+			item.Daemon = c.Daemon.Host
+		}
+
+		items = append(items, item)
+	}
+
+	return printOutput(os.Stdout, ctxArgs.output, items, func(w io.Writer) {
+		fmt.Fprintln(w, "CURRENT\tNAME\tREGISTRY\tWELL-KNOWN REGISTRY\tDAEMON")
+		for _, c := range items {
+			mark := ""
+			if c.Current {
+				mark = "*"
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", mark, c.Name, c.Registry, c.RegistryName, c.Daemon)
+		}
+	})
+}
+
+// purgeContexts removes contexts of the names, or all contexts if no name given. The current context is kept
+// unless forced.
+func purgeContexts(names []string) (err error) {
+	if len(names) == 0 {
+		var contexts []*ctx.Context
+		if contexts, err = ctx.List(); err != nil {
+			return
+		}
+
+		for _, c := range contexts {
+			names = append(names, c.Name)
+		}
+	}
+
+	current := currentContextName()
+	for _, name := range names {
+		if name == current && !ctxArgs.force {
+			if ctxArgs.all {
+				fmt.Printf("context %s is kept since it is used, remove it with --force\n", name)
+				continue
+			}
+
+			return fmt.Errorf("context %s is used, remove it with --force", name)
+		}
+
+		if err = ctx.Purge(name); err != nil {
+			return
+		}
+
+		if name == current {
+			if err = ctx.Reset(); err != nil {
+				return
+			}
+		}
+
+		fmt.Printf("context %s is removed\n", name)
+	}
+
+	return
+}
 
 func init() {
 	rootCmd.AddCommand(contextCmd)
@@ -145,4 +428,31 @@ func init() {
 			"from the well-known registry in the context")
 	contextCmd.Flags().StringVar(&ctxArgs.registryName, "well-known-registry-in-context", ctx.ContextRegistry,
 		"This argument shouldn't be changed unless it occupies some domain already been used.")
+	contextCmd.Flags().StringVar(&ctxArgs.daemon.Host, "docker-host", "",
+		"The daemon used in the context if --host is not given, such as unix:///var/run/docker.sock, "+
+			"tcp://host:2376 or ssh://user@host. Environment variables like DOCKER_HOST are used if empty")
+	contextCmd.Flags().StringVar(&ctxArgs.daemon.TLSCACert, "tlscacert", "", "CA certificate to verify the daemon")
+	contextCmd.Flags().StringVar(&ctxArgs.daemon.TLSCert, "tlscert", "", "TLS certificate to connect to the daemon")
+	contextCmd.Flags().StringVar(&ctxArgs.daemon.TLSKey, "tlskey", "", "TLS key to connect to the daemon")
+	contextCmd.Flags().StringVar(&ctxArgs.daemon.APIVersion, "api-version", "",
+		"API version of the daemon. "+daemon.DefaultAPIVersion+" is used if empty")
+	contextCmd.Flags().StringVar(&ctxArgs.credentials.Username, "username", "",
+		"Username of the registry. Credentials in the docker config are used if empty")
+	contextCmd.Flags().BoolVar(&ctxArgs.passwordStdin, "password-stdin", false,
+		"Read the password of the registry from stdin")
+	contextCmd.Flags().BoolVar(&ctxArgs.insecureRegistry, "insecure-registry", false,
+		"Allow connecting to the registry over plain HTTP if HTTPS fails. Credentials are never sent over HTTP")
+	contextCmd.Flags().BoolVar(&ctxArgs.shell, "shell", false,
+		"Switch context only in the current shell")
+	contextCmd.Flags().BoolVar(&ctxArgs.global, "global", false,
+		"Switch context in all shells even if context-mode is multi-user in the config")
+	contextCmd.Flags().StringVar(&ctxArgs.promptInit, "init", "",
+		"Print the script of the shell, bash, zsh or fish, to show the current context in the prompt")
+	contextCmd.Flags().BoolVar(&ctxArgs.includeSecrets, "include-secrets", false,
+		"Keep TLS client certificates, keys and passwords of the daemon and the registry in the exported context")
+	contextCmd.Flags().StringVar(&ctxArgs.name, "name", "", "Import the context with another name")
+	contextCmd.Flags().BoolVar(&ctxArgs.all, "all", false, "Purge all contexts")
+	contextCmd.Flags().BoolVar(&ctxArgs.force, "force", false,
+		"Purge the current context too, or overwrite the existing context when importing")
+	contextCmd.Flags().StringVarP(&ctxArgs.output, "output", "o", outputTable, "Output format, table, json or yaml")
 }
@@ -0,0 +1,459 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/kitt1987/docker-papa/pkg/container"
+	"github.com/kitt1987/docker-papa/pkg/history"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"github.com/mattn/go-shellwords"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show or purge docker run commands recorded before recreating containers",
+	Long: `Show or purge docker run commands recorded before recreating containers.
+
+Samples:
+  List all recorded commands, or commands of a container,
+  docker-papa history list
+  docker-papa history list turtle
+
+  Show the latest 3 commands of a container in YAML,
+  docker-papa history show turtle --n 3 -o yaml
+
+  Show arguments changed between the 1st and the 2nd recorded commands, or between the 2 latest ones,
+  docker-papa history diff turtle 0 1
+  docker-papa history diff turtle -- -2 -1
+
+  Purge commands recorded 30 days ago,
+  docker-papa history purge --older-than 720h
+
+  Copy the history in YAML to JSON lines, then set "history-backend: jsonl" in ~/.docker-papa.yaml to use it,
+  docker-papa history migrate --from yaml --to jsonl`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(_ *cobra.Command, args []string) {
+		action := strings.ToLower(args[0])
+		args = args[1:]
+
+		var err error
+		switch action {
+		case "list":
+			if len(args) > 1 {
+				err = fmt.Errorf("at most 1 container name is allowed")
+				break
+			}
+
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			err = listHistory(name)
+		case "show":
+			if len(args) != 1 {
+				err = fmt.Errorf("exactly 1 container name is required")
+				break
+			}
+
+			err = showHistory(args[0])
+		case "diff":
+			if len(args) != 3 {
+				err = fmt.Errorf("a container name and 2 records are required")
+				break
+			}
+
+			err = diffHistory(args[0], args[1], args[2])
+		case "purge":
+			if len(args) > 1 {
+				err = fmt.Errorf("at most 1 container name is allowed")
+				break
+			}
+
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+
+			err = purgeHistory(name)
+		case "migrate":
+			err = migrateHistory()
+		default:
+			err = fmt.Errorf("unknown action %s, only list, show, diff, purge and migrate are supported", action)
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(2)
+		}
+	},
+}
+
+type historyArgs struct {
+	n         int
+	olderThan time.Duration
+	all       bool
+	output    string
+	from      string
+	to        string
+}
+
+var hisArgs historyArgs
+
+// historyRecord is a docker run command recorded before a recreation. Index is the order of the record among
+// records of the same container, starting from 0.
+type historyRecord struct {
+	Name    string    `json:"name" yaml:"name"`
+	Index   int       `json:"index" yaml:"index"`
+	Time    time.Time `json:"time" yaml:"time"`
+	Command string    `json:"command" yaml:"command"`
+	Host    string    `json:"host,omitempty" yaml:"host,omitempty"`
+	User    string    `json:"user,omitempty" yaml:"user,omitempty"`
+	// Detail is nil for records written by old versions.
+	Detail *container.RecreateRecord `json:"detail,omitempty" yaml:"detail,omitempty"`
+	// entry is the entry in the history the record is from.
+	entry history.Entry
+}
+
+type historyDiff struct {
+	Name    string        `json:"name" yaml:"name"`
+	From    historyRecord `json:"from" yaml:"from"`
+	To      historyRecord `json:"to" yaml:"to"`
+	Removed []string      `json:"removed" yaml:"removed"`
+	Added   []string      `json:"added" yaml:"added"`
+}
+
+const (
+	historyTimeFormat    = "2006-01-02 15:04:05"
+	historyCommandLength = 80
+)
+
+func openHistory() (f history.File, err error) {
+	f, err = container.OpenRecreateHistory()
+	if err != nil {
+		err = fmt.Errorf("fail to open recreate history cuz %s", err)
+	}
+
+	return
+}
+
+// historyRecords returns records of the container, or records of all containers if name is empty.
+func historyRecords(f history.File, name string) (records []historyRecord, err error) {
+	key := ""
+	if len(name) > 0 {
+		key = container.RecreateHistoryKey(name)
+	}
+
+	indices := make(map[string]int)
+	for _, entry := range f.Entries(key) {
+		var detail *container.RecreateRecord
+		if detail, err = container.ParseRecreateRecord(&entry); err != nil {
+			return
+		}
+
+		recordName := container.RecreateHistoryName(entry.Key)
+		records = append(records, historyRecord{
+			Name:    recordName,
+			Index:   indices[recordName],
+			Time:    entry.Time,
+			Command: entry.Content,
+			Host:    entry.Host,
+			User:    entry.User,
+			Detail:  detail,
+			entry:   entry,
+		})
+
+		indices[recordName]++
+	}
+
+	return
+}
+
+func containerHistoryRecords(f history.File, name string) (records []historyRecord, err error) {
+	if records, err = historyRecords(f, name); err != nil {
+		return
+	}
+
+	if len(records) == 0 {
+		err = fmt.Errorf("container %s has never been recreated", name)
+	}
+
+	return
+}
+
+// historyRecordAt returns the record at an index, or the latest one recorded before a time like
+// "2019-05-20 14:00:00" in local or RFC3339.
+func historyRecordAt(records []historyRecord, indexOrTime string) (r historyRecord, err error) {
+	if i, err := strconv.Atoi(indexOrTime); err == nil {
+		if i < 0 {
+			i += len(records)
+		}
+
+		if i < 0 || i >= len(records) {
+			return r, fmt.Errorf("index %s is out of range, only %d records found", indexOrTime, len(records))
+		}
+
+		return records[i], nil
+	}
+
+	t, err := time.ParseInLocation(historyTimeFormat, indexOrTime, time.Local)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, indexOrTime); err != nil {
+			err = fmt.Errorf("%s is neither an index nor a time like \"%s\"", indexOrTime, historyTimeFormat)
+			return
+		}
+	}
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if !records[i].Time.After(t) {
+			r = records[i]
+			return
+		}
+	}
+
+	err = fmt.Errorf("no record found before %s", indexOrTime)
+	return
+}
+
+func listHistory(name string) (err error) {
+	f, err := openHistory()
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	records, err := historyRecords(f, name)
+	if err != nil {
+		return
+	}
+
+	return printOutput(os.Stdout, hisArgs.output, records, func(w io.Writer) {
+		fmt.Fprintln(w, "NAME\tINDEX\tTIME\tCOMMAND")
+		for _, r := range records {
+			cmd := r.Command
+			if len(cmd) > historyCommandLength {
+				cmd = cmd[:historyCommandLength-3] + "..."
+			}
+
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", r.Name, r.Index, r.Time.Local().Format(historyTimeFormat), cmd)
+		}
+	})
+}
+
+func showHistory(name string) (err error) {
+	f, err := openHistory()
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	records, err := containerHistoryRecords(f, name)
+	if err != nil {
+		return
+	}
+
+	if hisArgs.n > 0 && len(records) > hisArgs.n {
+		records = records[len(records)-hisArgs.n:]
+	}
+
+	return printOutput(os.Stdout, hisArgs.output, records, func(w io.Writer) {
+		for i, r := range records {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+
+			fmt.Fprintf(w, "#%d %s", r.Index, r.Time.Local().Format(historyTimeFormat))
+			if len(r.User) > 0 {
+				fmt.Fprintf(w, " by %s", r.User)
+			}
+
+			if len(r.Host) > 0 {
+				fmt.Fprintf(w, " on %s", r.Host)
+			}
+
+			fmt.Fprintln(w)
+			if r.Detail != nil && len(r.Detail.ImageID) > 0 {
+				fmt.Fprintf(w, "Image: %s\n", r.Detail.ImageID)
+				for _, digest := range r.Detail.RepoDigests {
+					fmt.Fprintf(w, "Digest: %s\n", digest)
+				}
+			}
+
+			fmt.Fprintln(w, r.Command)
+		}
+	})
+}
+
+func diffHistory(name, from, to string) (err error) {
+	f, err := openHistory()
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	records, err := containerHistoryRecords(f, name)
+	if err != nil {
+		return
+	}
+
+	d := historyDiff{Name: name}
+	if d.From, err = historyRecordAt(records, from); err != nil {
+		return
+	}
+
+	if d.To, err = historyRecordAt(records, to); err != nil {
+		return
+	}
+
+	// Specs are compared if both records have, so that how commands were generated never matters.
+	bySpec := d.From.Detail != nil && d.To.Detail != nil
+	fromArgs, err := recordArguments(&d.From, bySpec)
+	if err != nil {
+		return
+	}
+
+	toArgs, err := recordArguments(&d.To, bySpec)
+	if err != nil {
+		return
+	}
+
+	d.Removed = subtractArguments(fromArgs, toArgs)
+	d.Added = subtractArguments(toArgs, fromArgs)
+	return printOutput(os.Stdout, hisArgs.output, d, func(w io.Writer) {
+		if len(d.Removed) == 0 && len(d.Added) == 0 {
+			fmt.Fprintf(w, "Record #%d and #%d of container %s are the same\n", d.From.Index, d.To.Index, name)
+			return
+		}
+
+		fmt.Fprintf(w, "--- %s #%d (%s)\n", name, d.From.Index, d.From.Time.Local().Format(historyTimeFormat))
+		fmt.Fprintf(w, "+++ %s #%d (%s)\n", name, d.To.Index, d.To.Time.Local().Format(historyTimeFormat))
+		for _, arg := range d.Removed {
+			fmt.Fprintf(w, "- %s\n", arg)
+		}
+
+		for _, arg := range d.Added {
+			fmt.Fprintf(w, "+ %s\n", arg)
+		}
+	})
+}
+
+// boolRunFlags are flags of docker run which never take a separated value.
+var boolRunFlags = map[string]bool{
+	"-d": true, "--detach": true, "-i": true, "--interactive": true, "-t": true, "--tty": true,
+	"-P": true, "--publish-all": true, "--privileged": true, "--init": true, "--read-only": true, "--rm": true,
+	"--oom-kill-disable": true, "--no-healthcheck": true, "--sig-proxy": true,
+}
+
+// recordArguments returns arguments of the command of a record, which are generated from the spec of the record
+// if bySpec is true.
+func recordArguments(r *historyRecord, bySpec bool) ([]string, error) {
+	if bySpec {
+		return r.Detail.CommandArguments(r.Name)
+	}
+
+	return commandArguments(r.Command)
+}
+
+// commandArguments splits a recorded command into arguments. A flag and its value are kept in one argument.
+func commandArguments(cmd string) (args []string, err error) {
+	words, err := shellwords.Parse(cmd)
+	if err != nil {
+		err = fmt.Errorf("fail to parse command %s cuz %s", cmd, err)
+		return
+	}
+
+	for i := 0; i < len(words); i++ {
+		arg := utils.ShellQuote(words[i])
+		if strings.HasPrefix(words[i], "-") && !strings.Contains(words[i], "=") && !boolRunFlags[words[i]] &&
+			i+1 < len(words) {
+			i++
+			arg += " " + utils.ShellQuote(words[i])
+		}
+
+		args = append(args, arg)
+	}
+
+	return
+}
+
+// subtractArguments returns arguments in a but not in b. Duplicated arguments are counted.
+func subtractArguments(a, b []string) (diff []string) {
+	counts := make(map[string]int)
+	for _, arg := range b {
+		counts[arg]++
+	}
+
+	for _, arg := range a {
+		if counts[arg] > 0 {
+			counts[arg]--
+			continue
+		}
+
+		diff = append(diff, arg)
+	}
+
+	return
+}
+
+func purgeHistory(name string) (err error) {
+	if len(name) == 0 && hisArgs.olderThan == 0 && !hisArgs.all {
+		err = fmt.Errorf("a container name, --older-than or --all is required to purge history")
+		return
+	}
+
+	f, err := openHistory()
+	if err != nil {
+		return
+	}
+
+	key := ""
+	if len(name) > 0 {
+		key = container.RecreateHistoryKey(name)
+	}
+
+	before := time.Now()
+	if hisArgs.olderThan > 0 {
+		before = before.Add(-hisArgs.olderThan)
+	}
+
+	purged := f.Purge(key, before)
+	if err = f.Close(); err != nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, "%d records purged\n", purged)
+	return
+}
+
+func migrateHistory() (err error) {
+	migrated, err := container.MigrateRecreateHistory(hisArgs.from, hisArgs.to)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, "%d records migrated from %s to %s\n", migrated, hisArgs.from, hisArgs.to)
+	return
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+
+	historyCmd.Flags().IntVar(&hisArgs.n, "n", 0, "Show only the latest n records. All records are shown if 0")
+	historyCmd.Flags().DurationVar(&hisArgs.olderThan, "older-than", 0,
+		"Purge only records older than the duration, such as 720h")
+	historyCmd.Flags().BoolVar(&hisArgs.all, "all", false, "Purge records of all containers")
+	historyCmd.Flags().StringVar(&hisArgs.from, "from", history.BackendYAML,
+		"The backend to migrate history from, yaml or jsonl")
+	historyCmd.Flags().StringVar(&hisArgs.to, "to", history.BackendJSONLines,
+		"The backend to migrate history to, yaml or jsonl")
+	historyCmd.Flags().StringVarP(&hisArgs.output, "output", "o", outputTable, "Output format, table, json or yaml")
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// printOutput writes obj to w in JSON or YAML, or calls table to write a human-readable table.
+func printOutput(w io.Writer, format string, obj interface{}, table func(w io.Writer)) (err error) {
+	switch strings.ToLower(format) {
+	case "", outputTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		table(tw)
+		err = tw.Flush()
+	case outputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(obj)
+	case outputYAML:
+		err = yaml.NewEncoder(w).Encode(obj)
+	default:
+		err = fmt.Errorf("unknown output format %s, only table, json and yaml are supported", format)
+	}
+
+	return
+}
@@ -16,10 +16,12 @@ package cmd
 
 import (
 	"fmt"
+	"github.com/docker/go-units"
 	"github.com/kitt1987/docker-papa/pkg/ctx"
 	"github.com/kitt1987/docker-papa/pkg/image"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -49,9 +51,26 @@ to quickly create a Cobra application.`,
 				os.Exit(2)
 			}
 
-			err = image.PushDirectly(args[0], context.Registry)
+			var chunkSize int64
+			if chunkSize, err = units.RAMInBytes(pushArgs.chunkSize); err != nil {
+				fmt.Fprintf(os.Stderr, "invalid chunk size %s: %s\n", pushArgs.chunkSize, err)
+				os.Exit(2)
+			}
+
+			err = image.PushDirectly(args[0], context.Registry, dockerDaemonSocket, &image.PushOptions{
+				Credentials:      context.Credentials,
+				Insecure:         context.InsecureRegistry,
+				Compression:      image.Compression(pushArgs.compression),
+				CompressionLevel: pushArgs.compressionLevel,
+				Parallelism:      pushArgs.parallelism,
+				ChunkSize:        chunkSize,
+				Retries:          pushArgs.retries,
+				BlobTimeout:      pushArgs.blobTimeout,
+				Progress:         image.ProgressMode(pushArgs.progress),
+				Quiet:            pushArgs.quiet,
+			})
 		} else {
-			err = image.Push(args[0])
+			err = image.Push(args[0], dockerDaemonSocket, pushArgs.quiet)
 		}
 
 		if err != nil {
@@ -59,10 +78,28 @@ to quickly create a Cobra application.`,
 			os.Exit(2)
 		}
 
-		fmt.Printf("Image %s pushed", args[0])
+		if pushArgs.quiet {
+			fmt.Println(args[0])
+			return
+		}
+
+		fmt.Printf("Image %s pushed\n", args[0])
 	},
 }
 
+type pushArguments struct {
+	compression      string
+	compressionLevel int
+	parallelism      int
+	chunkSize        string
+	retries          int
+	blobTimeout      time.Duration
+	progress         string
+	quiet            bool
+}
+
+var pushArgs pushArguments
+
 func init() {
 	rootCmd.AddCommand(pushCmd)
 
@@ -75,4 +112,21 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// pushCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	pushCmd.Flags().StringVar(&pushArgs.compression, "compression", string(image.CompressionGzip),
+		"Compression of layers pushed to the registry in the context, gzip, zstd or none. "+
+			"zstd requires the zstd command and OCI-compatible registries")
+	pushCmd.Flags().IntVar(&pushArgs.compressionLevel, "compression-level", image.DefaultCompressionLevel,
+		"Compression level, 1-9 for gzip and 1-19 for zstd. The default level is used if 0")
+	pushCmd.Flags().IntVar(&pushArgs.parallelism, "max-concurrent-uploads", image.DefaultParallelism,
+		"Number of layers uploaded concurrently to the registry in the context")
+	pushCmd.Flags().StringVar(&pushArgs.chunkSize, "chunk-size", units.BytesSize(image.DefaultChunkSize),
+		"Size of each chunk uploaded. An interrupted upload is resumed from the last chunk the registry received")
+	pushCmd.Flags().IntVar(&pushArgs.retries, "retries", image.DefaultRetries,
+		"Retries of each layer with exponential backoff")
+	pushCmd.Flags().DurationVar(&pushArgs.blobTimeout, "blob-timeout", image.DefaultBlobTimeout,
+		"Timeout of uploading each layer, including retries")
+	pushCmd.Flags().StringVar(&pushArgs.progress, "progress", string(image.ProgressAuto),
+		"Progress of pushing to the registry in the context, auto, tty or plain. "+
+			"plain prints a line once a layer changes, which fits CI logs")
+	pushCmd.Flags().BoolVarP(&pushArgs.quiet, "quiet", "q", false, "Suppress the progress")
 }
@@ -21,11 +21,22 @@ import (
 	"os/exec"
 	"syscall"
 
+	"github.com/kitt1987/docker-papa/pkg/history"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
+const (
+	// historyMaxSizeConfig is the config of the maximum number of records kept in each history.
+	historyMaxSizeConfig = "history-max-size"
+	// historyBackendConfig is the config of the backend of histories, yaml or jsonl.
+	historyBackendConfig = "history-backend"
+	// contextModeConfig is the default scope of switched contexts. A context is switched only in the current shell
+	// if it is multi-user.
+	contextModeConfig = "context-mode"
+)
+
 var cfgFile string
 var dockerDaemonSocket string
 
@@ -98,6 +109,15 @@ func initConfig() {
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		// Keep stdout clean for outputs in JSON or YAML.
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	}
+
+	if viper.IsSet(historyMaxSizeConfig) {
+		history.MaxSize = viper.GetInt(historyMaxSizeConfig)
+	}
+
+	if viper.IsSet(historyBackendConfig) {
+		history.Backend = viper.GetString(historyBackendConfig)
 	}
 }
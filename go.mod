@@ -19,7 +19,7 @@ require (
 	github.com/inconshreveable/mousetrap v1.0.0
 	github.com/konsorten/go-windows-terminal-sequences v1.0.1
 	github.com/magiconair/properties v1.8.0
-	github.com/mattn/go-shellwords v1.0.5 // indirect
+	github.com/mattn/go-shellwords v1.0.5
 	github.com/mitchellh/go-homedir v1.0.0
 	github.com/mitchellh/mapstructure v1.0.0
 	github.com/opencontainers/go-digest v1.0.0-rc1
@@ -1,6 +1,16 @@
 package container
 
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"io"
+	"time"
+)
+
 type RecreateOptions struct {
+	// Spec replaces the spec of the container before other options are applied, e.g. to roll back to a spec
+	// recorded in the history.
+	Spec             *RunSpec
 	Image            string
 	RestartAlways    bool
 	Network          string
@@ -14,9 +24,44 @@ type RecreateOptions struct {
 	RenewCmd         bool
 	Rename           string
 	KeepFiles        []string
+	DryRun           bool
+	// WaitHealthy makes recreation wait for the new container to become healthy, or keep running in GracePeriod
+	// if no healthcheck is defined. The original container is restored on failure.
+	WaitHealthy   bool
+	HealthTimeout time.Duration
+	GracePeriod   time.Duration
+	// Output receives messages of the recreation, including errors, instead of stdout and stderr if set.
+	Output io.Writer `json:"-"`
+}
+
+// RunSpec is what a docker run command specifies.
+type RunSpec struct {
+	Name             string
+	Config           *container.Config
+	HostConfig       *container.HostConfig
+	NetworkingConfig *network.NetworkingConfig
+}
+
+type CommandOptions struct {
+	// Multiline breaks the command into lines continued by backslashes.
+	Multiline bool
+	// Foreground omits -d and --restart so that the container could be supervised by others.
+	Foreground bool
+}
+
+type SystemdOptions struct {
+	// Docker is the path of the docker client. /usr/bin/docker is used if empty.
+	Docker string
+	// Host is the daemon the unit connects to. The daemon of the current context is used if empty.
+	Host      string
+	Multiline bool
 }
 
 type DockerContainer interface {
+	Name() string
 	Recreate(*RecreateOptions) (newID string, err error)
-	ConvertToDockerCommand() (string, error)
+	ConvertToDockerCommand(*CommandOptions) (string, error)
+	ConvertToComposeService() (service *ComposeService, volumes, networks []string, err error)
+	ConvertToKubernetesManifests() (manifests []interface{}, warnings []string, err error)
+	ConvertToSystemdUnit(*SystemdOptions) (string, error)
 }
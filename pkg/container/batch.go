@@ -0,0 +1,206 @@
+package container
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// ErrSkipped is the result of containers not recreated since another one failed.
+var ErrSkipped = errors.New("skipped")
+
+type RecreateResult struct {
+	Name  string
+	NewID string
+	Err   error
+}
+
+// ListExistedDockerContainers returns all containers matching filterArgs, e.g. label=app=turtle or
+// ancestor=turtle:1.7.0. Legacy containers left by recreation are excluded. Containers are sorted by name.
+func ListExistedDockerContainers(filterArgs []string, daemon string) (containers []DockerContainer, err error) {
+	cli, err := newDockerClient(daemon)
+	if err != nil {
+		return
+	}
+
+	if len(filterArgs) == 0 {
+		err = fmt.Errorf("at least 1 filter is required")
+		return
+	}
+
+	containerFilter := filters.NewArgs()
+	for _, arg := range filterArgs {
+		if containerFilter, err = filters.ParseFlag(arg, containerFilter); err != nil {
+			return
+		}
+	}
+
+	ctx := context.Background()
+	matched, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: containerFilter,
+	})
+
+	if err != nil {
+		return
+	}
+
+	if len(matched) == 0 {
+		err = fmt.Errorf("no container matched %s", strings.Join(filterArgs, ","))
+		return
+	}
+
+	for _, m := range matched {
+		if isLegacy(m.Names) {
+			continue
+		}
+
+		var c *dockerContainer
+		if c, err = loadDockerContainer(ctx, cli, m.ID); err != nil {
+			return
+		}
+
+		containers = append(containers, c)
+	}
+
+	if len(containers) == 0 {
+		err = fmt.Errorf("only legacy containers matched %s", strings.Join(filterArgs, ","))
+		return
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Name() < containers[j].Name()
+	})
+
+	return
+}
+
+func isLegacy(names []string) bool {
+	for _, name := range names {
+		if strings.HasSuffix(name, legacySuffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RecreateAll recreates containers with at most parallelism ones at the same time. No more container will be
+// recreated after the first failure. Results are in the same order of containers.
+func RecreateAll(containers []DockerContainer, opts *RecreateOptions, parallelism int) (results []RecreateResult) {
+	return recreateAll(containers, opts, parallelism, 0)
+}
+
+type RollingOptions struct {
+	// MaxUnavailable is the max number of containers being recreated at the same time.
+	MaxUnavailable int
+	// Delay is how long to wait after a container is recreated before recreating the next one.
+	Delay time.Duration
+}
+
+// RollingRecreate recreates containers in a rolling fashion. Each new container must become healthy, or keep
+// running in the grace period if no healthcheck defined, before the next one is recreated. The rollout halts on
+// the first failure and the failed container is restored.
+func RollingRecreate(containers []DockerContainer, opts *RecreateOptions, rolling *RollingOptions) (
+	results []RecreateResult) {
+	copied := *opts
+	copied.WaitHealthy = true
+	return recreateAll(containers, &copied, rolling.MaxUnavailable, rolling.Delay)
+}
+
+func recreateAll(containers []DockerContainer, opts *RecreateOptions, parallelism int, delay time.Duration) (
+	results []RecreateResult) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	results = make([]RecreateResult, len(containers))
+	for i, c := range containers {
+		results[i] = RecreateResult{Name: c.Name(), Err: ErrSkipped}
+	}
+
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		failed bool
+	)
+
+	// Messages of containers recreated in parallel are buffered and printed as a block once each one is done,
+	// so that they are not interleaved.
+	buffered := parallelism > 1 && len(containers) > 1
+
+	tokens := make(chan struct{}, parallelism)
+	for i := range containers {
+		tokens <- struct{}{}
+		lock.Lock()
+		stop := failed
+		lock.Unlock()
+		if stop {
+			<-tokens
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+
+			// Every recreation has its own copy of options.
+			copied := *opts
+			var output bytes.Buffer
+			if buffered {
+				copied.Output = &output
+			}
+
+			newID, err := containers[i].Recreate(&copied)
+			lock.Lock()
+			if buffered {
+				fmt.Fprintf(os.Stdout, "==> %s\n", containers[i].Name())
+				output.WriteTo(os.Stdout)
+			}
+
+			results[i].NewID = newID
+			results[i].Err = err
+			if err != nil {
+				failed = true
+			}
+
+			lock.Unlock()
+			if err == nil && delay > 0 && i < len(containers)-1 {
+				time.Sleep(delay)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	return
+}
+
+func PrintRecreateResults(w io.Writer, results []RecreateResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONTAINER\tRESULT\tDETAIL")
+	for _, r := range results {
+		switch {
+		case r.Err == ErrSkipped:
+			fmt.Fprintf(tw, "%s\tskipped\t\n", r.Name)
+		case r.Err != nil:
+			fmt.Fprintf(tw, "%s\tfailed\t%s\n", r.Name, r.Err)
+		default:
+			fmt.Fprintf(tw, "%s\trecreated\t%s\n", r.Name, r.NewID)
+		}
+	}
+
+	tw.Flush()
+}
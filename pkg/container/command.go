@@ -0,0 +1,478 @@
+package container
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultShmSize = 64 * 1024 * 1024
+)
+
+// runArgs is the argument list of a docker run command. Arguments are grouped, e.g. a flag and its value, so that
+// each group could be put in a line.
+type runArgs struct {
+	groups [][]string
+	// warnings are settings of the container which can't be expressed by the command.
+	warnings []string
+}
+
+// add appends args as a group.
+func (a *runArgs) add(args ...string) {
+	if len(args) > 0 {
+		a.groups = append(a.groups, args)
+	}
+}
+
+// flag appends the flag once for each value.
+func (a *runArgs) flag(name string, values ...string) {
+	for _, v := range values {
+		a.add(name, v)
+	}
+}
+
+func (a *runArgs) warn(format string, args ...interface{}) {
+	a.warnings = append(a.warnings, fmt.Sprintf(format, args...))
+}
+
+func (a *runArgs) printWarnings(w io.Writer) {
+	for _, warning := range a.warnings {
+		fmt.Fprintln(w, "warning:", warning)
+	}
+}
+
+func (a *runArgs) flagIf(cond bool, name string) {
+	if cond {
+		a.add(name)
+	}
+}
+
+func (a *runArgs) flagIfNotEmpty(name, value string) {
+	if len(value) > 0 {
+		a.add(name, value)
+	}
+}
+
+func (a *runArgs) flagIfNotZero(name string, value int64) {
+	if value != 0 {
+		a.add(name, strconv.FormatInt(value, 10))
+	}
+}
+
+func (a *runArgs) flagMap(name string, m map[string]string) {
+	for _, k := range sortedKeys(m) {
+		a.add(name, k+"="+m[k])
+	}
+}
+
+// String returns the command in which every argument is quoted by quote.
+func (a *runArgs) String(quote func(string) string, multiline bool) string {
+	lines := make([]string, len(a.groups))
+	for i, g := range a.groups {
+		quoted := make([]string, len(g))
+		for j := range g {
+			quoted[j] = quote(g[j])
+		}
+
+		lines[i] = strings.Join(quoted, ` `)
+	}
+
+	if multiline {
+		return strings.Join(lines, " \\\n  ")
+	}
+
+	return strings.Join(lines, ` `)
+}
+
+func (c *dockerContainer) ConvertToDockerCommand(opts *CommandOptions) (cmd string, err error) {
+	if opts == nil {
+		opts = &CommandOptions{}
+	}
+
+	run := c.dockerRunArgs(opts.Foreground)
+	run.printWarnings(os.Stderr)
+	cmd = run.String(utils.ShellQuote, opts.Multiline)
+	return
+}
+
+// dockerRunArgs returns arguments of a docker run command which creates an equivalent container. Settings
+// inherited from the image are omitted. In the foreground mode, the container is neither detached nor restarted by
+// the daemon, so that it could be supervised by others.
+func (c *dockerContainer) dockerRunArgs(foreground bool) (a *runArgs) {
+	a = &runArgs{}
+	a.add(`docker`, `run`)
+	a.flag(`--name`, strings.TrimPrefix(c.containerInspectData.Name, "/"))
+	c.appendGeneralArgs(a, foreground)
+	c.appendNetworkArgs(a)
+	c.appendMountArgs(a)
+	c.appendResourceArgs(a)
+	c.appendSecurityArgs(a)
+	c.appendRuntimeArgs(a)
+	c.appendImageAndCommand(a)
+	return
+}
+
+func (c *dockerContainer) imageConfig() *container.Config {
+	if c.imageInspectData.Config != nil {
+		return c.imageInspectData.Config
+	}
+
+	return &container.Config{}
+}
+
+func (c *dockerContainer) appendGeneralArgs(a *runArgs, foreground bool) {
+	config := c.containerInspectData.Config
+	hostConfig := c.containerInspectData.HostConfig
+	imageConfig := c.imageConfig()
+
+	restart := hostConfig.RestartPolicy
+	switch {
+	case foreground:
+	case restart.MaximumRetryCount > 0:
+		a.flag(`--restart`, fmt.Sprintf(`%s:%d`, restart.Name, restart.MaximumRetryCount))
+	default:
+		a.flagIfNotEmpty(`--restart`, restart.Name)
+	}
+
+	a.flagIf(hostConfig.AutoRemove, `--rm`)
+
+	if !config.AttachStdin && !config.AttachStdout && !config.AttachStderr {
+		a.flagIf(!foreground, `-d`)
+	} else {
+		if config.AttachStdin {
+			a.flag(`-a`, `stdin`)
+		}
+
+		if config.AttachStdout {
+			a.flag(`-a`, `stdout`)
+		}
+
+		if config.AttachStderr {
+			a.flag(`-a`, `stderr`)
+		}
+	}
+
+	a.flagIf(config.OpenStdin, `-i`)
+	a.flagIf(config.Tty, `-t`)
+
+	if len(c.containerInspectData.ID) < 12 || config.Hostname != c.containerInspectData.ID[:12] {
+		if !hostConfig.NetworkMode.IsHost() && !hostConfig.NetworkMode.IsContainer() {
+			a.flagIfNotEmpty(`--hostname`, config.Hostname)
+		}
+	}
+
+	a.flagIfNotEmpty(`--domainname`, config.Domainname)
+	if config.User != imageConfig.User {
+		a.flagIfNotEmpty(`--user`, config.User)
+	}
+
+	a.flag(`--group-add`, hostConfig.GroupAdd...)
+	if config.WorkingDir != imageConfig.WorkingDir {
+		a.flagIfNotEmpty(`--workdir`, config.WorkingDir)
+	}
+
+	var labels []string
+	for _, k := range sortedKeys(config.Labels) {
+		if v, found := imageConfig.Labels[k]; !found || v != config.Labels[k] {
+			labels = append(labels, k+"="+config.Labels[k])
+		}
+	}
+
+	a.flag(`--label`, labels...)
+
+	envs := utils.Diff(config.Env, imageConfig.Env)
+	a.flag(`-e`, envs...)
+}
+
+func (c *dockerContainer) appendNetworkArgs(a *runArgs) {
+	config := c.containerInspectData.Config
+	hostConfig := c.containerInspectData.HostConfig
+	networkMode := hostConfig.NetworkMode
+
+	switch {
+	case networkMode.IsNone():
+		a.add(`--net=none`)
+	case networkMode.IsHost():
+		a.add(`--net=host`)
+	case networkMode.IsContainer():
+		a.add(`--net=container:` + networkMode.ConnectedContainer())
+	case networkMode.IsUserDefined():
+		a.add(`--net=` + networkMode.UserDefined())
+	}
+
+	if c.containerInspectData.NetworkSettings != nil {
+		if endpoint := c.containerInspectData.NetworkSettings.Networks[string(networkMode)]; endpoint != nil {
+			for _, alias := range endpoint.Aliases {
+				// Docker adds the short ID as an alias on user-defined networks.
+				if len(alias) != 12 || !strings.HasPrefix(c.containerInspectData.ID, alias) {
+					a.flag(`--network-alias`, alias)
+				}
+			}
+
+			if endpoint.IPAMConfig != nil {
+				a.flagIfNotEmpty(`--ip`, endpoint.IPAMConfig.IPv4Address)
+				a.flagIfNotEmpty(`--ip6`, endpoint.IPAMConfig.IPv6Address)
+			}
+		}
+	}
+
+	a.flagIfNotEmpty(`--mac-address`, config.MacAddress)
+
+	for _, link := range hostConfig.Links {
+		// Links are in the form of /name:/container/alias
+		parts := strings.SplitN(link, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		a.flag(`--link`, strings.TrimPrefix(parts[0], "/")+":"+path.Base(parts[1]))
+	}
+
+	a.flag(`--dns`, hostConfig.DNS...)
+	a.flag(`--dns-option`, hostConfig.DNSOptions...)
+	a.flag(`--dns-search`, hostConfig.DNSSearch...)
+	a.flag(`--add-host`, hostConfig.ExtraHosts...)
+	a.flagIf(hostConfig.PublishAllPorts, `-P`)
+
+	var ports []string
+	for port, binding := range hostConfig.PortBindings {
+		for _, hostPort := range binding {
+			switch {
+			case len(hostPort.HostIP) > 0:
+				ports = append(ports, fmt.Sprintf(`%s:%s:%s`, hostPort.HostIP, hostPort.HostPort, port))
+			case len(hostPort.HostPort) > 0:
+				ports = append(ports, fmt.Sprintf(`%s:%s`, hostPort.HostPort, port))
+			default:
+				ports = append(ports, string(port))
+			}
+		}
+	}
+
+	sort.Strings(ports)
+	a.flag(`-p`, ports...)
+
+	var exposed []string
+	for port := range config.ExposedPorts {
+		if _, inImage := c.imageConfig().ExposedPorts[port]; inImage {
+			continue
+		}
+
+		if _, published := hostConfig.PortBindings[port]; published {
+			continue
+		}
+
+		exposed = append(exposed, string(port))
+	}
+
+	sort.Strings(exposed)
+	a.flag(`--expose`, exposed...)
+}
+
+func (c *dockerContainer) appendMountArgs(a *runArgs) {
+	hostConfig := c.containerInspectData.HostConfig
+	a.flagIfNotEmpty(`--volume-driver`, hostConfig.VolumeDriver)
+	a.flag(`-v`, hostConfig.Binds...)
+	for _, volume := range anonymousVolumes(&c.containerInspectData) {
+		a.flag(`-v`, volumeToBind(volume))
+	}
+
+	for _, m := range hostConfig.Mounts {
+		a.flag(`--mount`, mountFlagValue(m))
+	}
+
+	a.flag(`--tmpfs`, tmpfsFlagValues(hostConfig)...)
+	a.flag(`--volumes-from`, hostConfig.VolumesFrom...)
+	a.flagIf(hostConfig.ReadonlyRootfs, `--read-only`)
+	a.flagMap(`--storage-opt`, hostConfig.StorageOpt)
+}
+
+func (c *dockerContainer) appendResourceArgs(a *runArgs) {
+	resources := c.containerInspectData.HostConfig.Resources
+	a.flagIfNotZero(`--memory`, resources.Memory)
+	a.flagIfNotZero(`--memory-reservation`, resources.MemoryReservation)
+	a.flagIfNotZero(`--memory-swap`, resources.MemorySwap)
+	if resources.MemorySwappiness != nil && *resources.MemorySwappiness >= 0 {
+		a.flag(`--memory-swappiness`, strconv.FormatInt(*resources.MemorySwappiness, 10))
+	}
+
+	a.flagIfNotZero(`--kernel-memory`, resources.KernelMemory)
+	if resources.NanoCPUs > 0 {
+		a.flag(`--cpus`, strconv.FormatFloat(float64(resources.NanoCPUs)/1e9, 'f', -1, 64))
+	}
+
+	a.flagIfNotZero(`--cpu-shares`, resources.CPUShares)
+	a.flagIfNotZero(`--cpu-period`, resources.CPUPeriod)
+	a.flagIfNotZero(`--cpu-quota`, resources.CPUQuota)
+	a.flagIfNotZero(`--cpu-rt-period`, resources.CPURealtimePeriod)
+	a.flagIfNotZero(`--cpu-rt-runtime`, resources.CPURealtimeRuntime)
+	a.flagIfNotEmpty(`--cpuset-cpus`, resources.CpusetCpus)
+	a.flagIfNotEmpty(`--cpuset-mems`, resources.CpusetMems)
+	a.flagIfNotZero(`--blkio-weight`, int64(resources.BlkioWeight))
+	for _, d := range resources.BlkioWeightDevice {
+		a.flag(`--blkio-weight-device`, d.String())
+	}
+
+	for _, d := range resources.BlkioDeviceReadBps {
+		a.flag(`--device-read-bps`, d.String())
+	}
+
+	for _, d := range resources.BlkioDeviceWriteBps {
+		a.flag(`--device-write-bps`, d.String())
+	}
+
+	for _, d := range resources.BlkioDeviceReadIOps {
+		a.flag(`--device-read-iops`, d.String())
+	}
+
+	for _, d := range resources.BlkioDeviceWriteIOps {
+		a.flag(`--device-write-iops`, d.String())
+	}
+
+	if resources.OomKillDisable != nil && *resources.OomKillDisable {
+		a.add(`--oom-kill-disable`)
+	}
+
+	a.flagIfNotZero(`--oom-score-adj`, int64(c.containerInspectData.HostConfig.OomScoreAdj))
+	if resources.PidsLimit > 0 {
+		a.flag(`--pids-limit`, strconv.FormatInt(resources.PidsLimit, 10))
+	}
+
+	a.flagIfNotEmpty(`--cgroup-parent`, resources.CgroupParent)
+	for _, ulimit := range resources.Ulimits {
+		a.flag(`--ulimit`, ulimit.String())
+	}
+
+	for _, d := range resources.Devices {
+		device := d.PathOnHost
+		if len(d.PathInContainer) > 0 {
+			device += ":" + d.PathInContainer
+		}
+
+		if len(d.CgroupPermissions) > 0 && d.CgroupPermissions != "rwm" {
+			device += ":" + d.CgroupPermissions
+		}
+
+		a.flag(`--device`, device)
+	}
+
+	a.flag(`--device-cgroup-rule`, resources.DeviceCgroupRules...)
+	if shmSize := c.containerInspectData.HostConfig.ShmSize; shmSize > 0 && shmSize != defaultShmSize {
+		a.flag(`--shm-size`, strconv.FormatInt(shmSize, 10))
+	}
+}
+
+func (c *dockerContainer) appendSecurityArgs(a *runArgs) {
+	hostConfig := c.containerInspectData.HostConfig
+	a.flagIf(hostConfig.Privileged, `--privileged`)
+	a.flag(`--cap-add`, hostConfig.CapAdd...)
+	a.flag(`--cap-drop`, hostConfig.CapDrop...)
+	a.flag(`--security-opt`, hostConfig.SecurityOpt...)
+	a.flagMap(`--sysctl`, hostConfig.Sysctls)
+	a.flagIfNotEmpty(`--userns`, string(hostConfig.UsernsMode))
+}
+
+func (c *dockerContainer) appendRuntimeArgs(a *runArgs) {
+	config := c.containerInspectData.Config
+	hostConfig := c.containerInspectData.HostConfig
+
+	a.flagIfNotEmpty(`--log-driver`, hostConfig.LogConfig.Type)
+	a.flagMap(`--log-opt`, hostConfig.LogConfig.Config)
+	a.flagIfNotEmpty(`--pid`, string(hostConfig.PidMode))
+	if ipc := hostConfig.IpcMode; !ipc.IsEmpty() && !ipc.IsPrivate() && !ipc.IsShareable() {
+		a.flag(`--ipc`, string(ipc))
+	}
+
+	a.flagIfNotEmpty(`--uts`, string(hostConfig.UTSMode))
+	if hostConfig.Init != nil && *hostConfig.Init {
+		a.add(`--init`)
+	}
+
+	if len(hostConfig.Runtime) > 0 && hostConfig.Runtime != "runc" {
+		a.flag(`--runtime`, hostConfig.Runtime)
+	}
+
+	if !hostConfig.Isolation.IsDefault() {
+		a.flag(`--isolation`, string(hostConfig.Isolation))
+	}
+
+	if config.StopSignal != c.imageConfig().StopSignal {
+		a.flagIfNotEmpty(`--stop-signal`, config.StopSignal)
+	}
+
+	if config.StopTimeout != nil {
+		a.flag(`--stop-timeout`, strconv.Itoa(*config.StopTimeout))
+	}
+
+	c.appendHealthcheckArgs(a)
+}
+
+func (c *dockerContainer) appendHealthcheckArgs(a *runArgs) {
+	hc := c.containerInspectData.Config.Healthcheck
+	if hc == nil || healthcheckEqual(hc, c.imageConfig().Healthcheck) {
+		return
+	}
+
+	if len(hc.Test) > 0 {
+		switch hc.Test[0] {
+		case "NONE":
+			a.add(`--no-healthcheck`)
+			return
+		case "CMD-SHELL":
+			a.flag(`--health-cmd`, strings.Join(hc.Test[1:], ` `))
+		case "CMD":
+			// --health-cmd is always run by the shell. Joining arguments would change how they are parsed.
+			a.warn("healthcheck %q in exec form can't be expressed by docker run. it is omitted",
+				strings.Join(hc.Test[1:], ` `))
+			return
+		}
+	}
+
+	if hc.Interval > 0 {
+		a.flag(`--health-interval`, hc.Interval.String())
+	}
+
+	a.flagIfNotZero(`--health-retries`, int64(hc.Retries))
+	if hc.Timeout > 0 {
+		a.flag(`--health-timeout`, hc.Timeout.String())
+	}
+
+	if hc.StartPeriod > 0 {
+		a.flag(`--health-start-period`, hc.StartPeriod.String())
+	}
+}
+
+func healthcheckEqual(a, b *container.HealthConfig) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return utils.SliceEqual(a.Test, b.Test) && a.Interval == b.Interval && a.Timeout == b.Timeout &&
+		a.StartPeriod == b.StartPeriod && a.Retries == b.Retries
+}
+
+// appendImageAndCommand appends the entrypoint, image and command. Since --entrypoint accepts only 1 executable,
+// other elements of the entrypoint are prepended to the command.
+func (c *dockerContainer) appendImageAndCommand(a *runArgs) {
+	config := c.containerInspectData.Config
+	cmd := strslice.StrSlice{}
+	if !utils.SliceEqual(config.Entrypoint, c.imageConfig().Entrypoint) {
+		if len(config.Entrypoint) > 0 && len(config.Entrypoint[0]) > 0 {
+			a.flag(`--entrypoint`, config.Entrypoint[0])
+			cmd = append(cmd, config.Entrypoint[1:]...)
+		} else {
+			// go-shellwords drops empty words like '', so the empty value is attached to the flag.
+			a.add(`--entrypoint=`)
+		}
+	}
+
+	cmd = append(cmd, config.Cmd...)
+	a.add(append([]string{config.Image}, cmd...)...)
+}
@@ -0,0 +1,361 @@
+package container
+
+import (
+	"encoding/json"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"github.com/mattn/go-shellwords"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAppendHealthcheckArgs(t *testing.T) {
+	cases := []struct {
+		name      string
+		container string
+		image     string
+		args      string
+		warnings  int
+	}{
+		{
+			name:      "no healthcheck",
+			container: `{"Config": {}}`,
+		},
+		{
+			name:      "inherited from image",
+			container: `{"Config": {"Healthcheck": {"Test": ["CMD-SHELL", "curl -f localhost"]}}}`,
+			image:     `{"Config": {"Healthcheck": {"Test": ["CMD-SHELL", "curl -f localhost"]}}}`,
+		},
+		{
+			name:      "shell form",
+			container: `{"Config": {"Healthcheck": {"Test": ["CMD-SHELL", "curl -f localhost || exit 1"]}}}`,
+			args:      `--health-cmd 'curl -f localhost || exit 1'`,
+		},
+		{
+			name: "shell form with options",
+			container: `{"Config": {"Healthcheck": {"Test": ["CMD-SHELL", "pg_isready"], "Interval": 10000000000,
+				"Timeout": 3000000000, "StartPeriod": 60000000000, "Retries": 3}}}`,
+			args: `--health-cmd pg_isready --health-interval 10s --health-retries 3 --health-timeout 3s ` +
+				`--health-start-period 1m0s`,
+		},
+		{
+			name:      "disabled",
+			container: `{"Config": {"Healthcheck": {"Test": ["NONE"]}}}`,
+			image:     `{"Config": {"Healthcheck": {"Test": ["CMD-SHELL", "true"]}}}`,
+			args:      `--no-healthcheck`,
+		},
+		{
+			name:      "exec form",
+			container: `{"Config": {"Healthcheck": {"Test": ["CMD", "/bin/check", "--url", "http://localhost/a b"]}}}`,
+			warnings:  1,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dc := &dockerContainer{}
+			if err := json.Unmarshal([]byte(c.container), &dc.containerInspectData); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(c.image) > 0 {
+				dc.imageInspectData = types.ImageInspect{}
+				if err := json.Unmarshal([]byte(c.image), &dc.imageInspectData); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			a := &runArgs{}
+			dc.appendHealthcheckArgs(a)
+			if args := a.String(utils.ShellQuote, false); args != c.args {
+				t.Errorf("expected args %q, but got %q", c.args, args)
+			}
+
+			if len(a.warnings) != c.warnings {
+				t.Errorf("expected %d warnings, but got %v", c.warnings, a.warnings)
+			}
+		})
+	}
+}
+
+func TestRunArgsString(t *testing.T) {
+	a := &runArgs{}
+	a.add(`docker`, `run`)
+	a.flag(`--env`, `A=1`, `B=a b`)
+	if cmd := a.String(utils.ShellQuote, true); cmd != "docker run \\\n  --env A=1 \\\n  --env 'B=a b'" {
+		t.Errorf("unexpected command %q", cmd)
+	}
+
+	if !reflect.DeepEqual(a.groups[1], []string{`--env`, `A=1`}) {
+		t.Errorf("unexpected groups %v", a.groups)
+	}
+}
+
+func TestDockerCommandRoundTrip(t *testing.T) {
+	init, stopTimeout := true, 30
+	cases := []struct {
+		name     string
+		apply    func(c *types.ContainerJSON)
+		field    func(spec *RunSpec) interface{}
+		expected interface{}
+	}{
+		{
+			name: "labels",
+			apply: func(c *types.ContainerJSON) {
+				c.Config.Labels = map[string]string{"app": "web", "tier": "front end"}
+			},
+			field:    func(spec *RunSpec) interface{} { return spec.Config.Labels },
+			expected: map[string]string{"app": "web", "tier": "front end"},
+		},
+		{
+			name:     "user",
+			apply:    func(c *types.ContainerJSON) { c.Config.User = "1000:1000" },
+			field:    func(spec *RunSpec) interface{} { return spec.Config.User },
+			expected: "1000:1000",
+		},
+		{
+			name:     "workdir",
+			apply:    func(c *types.ContainerJSON) { c.Config.WorkingDir = "/srv/web app" },
+			field:    func(spec *RunSpec) interface{} { return spec.Config.WorkingDir },
+			expected: "/srv/web app",
+		},
+		{
+			name: "hostname and domainname",
+			apply: func(c *types.ContainerJSON) {
+				c.Config.Hostname = "web"
+				c.Config.Domainname = "example.com"
+			},
+			field:    func(spec *RunSpec) interface{} { return []string{spec.Config.Hostname, spec.Config.Domainname} },
+			expected: []string{"web", "example.com"},
+		},
+		{
+			name: "memory limits",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.Memory = 512 * 1024 * 1024
+				c.HostConfig.MemoryReservation = 256 * 1024 * 1024
+				c.HostConfig.MemorySwap = -1
+			},
+			field: func(spec *RunSpec) interface{} {
+				r := spec.HostConfig.Resources
+				return []int64{r.Memory, r.MemoryReservation, r.MemorySwap}
+			},
+			expected: []int64{512 * 1024 * 1024, 256 * 1024 * 1024, -1},
+		},
+		{
+			name: "cpu limits",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.NanoCPUs = 1500000000
+				c.HostConfig.CPUShares = 512
+				c.HostConfig.CpusetCpus = "0,1"
+			},
+			field: func(spec *RunSpec) interface{} {
+				r := spec.HostConfig.Resources
+				return []interface{}{r.NanoCPUs, r.CPUShares, r.CpusetCpus}
+			},
+			expected: []interface{}{int64(1500000000), int64(512), "0,1"},
+		},
+		{
+			name: "ulimits",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.Ulimits = []*units.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}}
+			},
+			field:    func(spec *RunSpec) interface{} { return spec.HostConfig.Ulimits },
+			expected: []*units.Ulimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+		},
+		{
+			name: "capabilities",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.CapAdd = strslice.StrSlice{"NET_ADMIN", "SYS_TIME"}
+				c.HostConfig.CapDrop = strslice.StrSlice{"MKNOD"}
+			},
+			field: func(spec *RunSpec) interface{} {
+				return [][]string{spec.HostConfig.CapAdd, spec.HostConfig.CapDrop}
+			},
+			expected: [][]string{{"NET_ADMIN", "SYS_TIME"}, {"MKNOD"}},
+		},
+		{
+			name: "security options",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.SecurityOpt = []string{"no-new-privileges", "seccomp=unconfined"}
+			},
+			field:    func(spec *RunSpec) interface{} { return spec.HostConfig.SecurityOpt },
+			expected: []string{"no-new-privileges", "seccomp=unconfined"},
+		},
+		{
+			name: "devices",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.Devices = []container.DeviceMapping{
+					{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rwm"},
+					{PathOnHost: "/dev/sda", PathInContainer: "/dev/xvda", CgroupPermissions: "r"},
+				}
+			},
+			field: func(spec *RunSpec) interface{} { return spec.HostConfig.Devices },
+			expected: []container.DeviceMapping{
+				{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rwm"},
+				{PathOnHost: "/dev/sda", PathInContainer: "/dev/xvda", CgroupPermissions: "r"},
+			},
+		},
+		{
+			name: "sysctls",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.Sysctls = map[string]string{"net.core.somaxconn": "1024"}
+			},
+			field:    func(spec *RunSpec) interface{} { return spec.HostConfig.Sysctls },
+			expected: map[string]string{"net.core.somaxconn": "1024"},
+		},
+		{
+			name:     "shm size",
+			apply:    func(c *types.ContainerJSON) { c.HostConfig.ShmSize = 128 * 1024 * 1024 },
+			field:    func(spec *RunSpec) interface{} { return spec.HostConfig.ShmSize },
+			expected: int64(128 * 1024 * 1024),
+		},
+		{
+			name: "log driver and options",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.LogConfig = container.LogConfig{Type: "json-file",
+					Config: map[string]string{"max-size": "10m", "max-file": "3"}}
+			},
+			field: func(spec *RunSpec) interface{} { return spec.HostConfig.LogConfig },
+			expected: container.LogConfig{Type: "json-file",
+				Config: map[string]string{"max-size": "10m", "max-file": "3"}},
+		},
+		{
+			name: "pid, ipc and uts modes",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.PidMode = "host"
+				c.HostConfig.IpcMode = "container:db"
+				c.HostConfig.UTSMode = "host"
+			},
+			field: func(spec *RunSpec) interface{} {
+				hc := spec.HostConfig
+				return []string{string(hc.PidMode), string(hc.IpcMode), string(hc.UTSMode)}
+			},
+			expected: []string{"host", "container:db", "host"},
+		},
+		{
+			name:     "init",
+			apply:    func(c *types.ContainerJSON) { c.HostConfig.Init = &init },
+			field:    func(spec *RunSpec) interface{} { return spec.HostConfig.Init },
+			expected: &init,
+		},
+		{
+			name: "stop signal and timeout",
+			apply: func(c *types.ContainerJSON) {
+				c.Config.StopSignal = "SIGINT"
+				c.Config.StopTimeout = &stopTimeout
+			},
+			field: func(spec *RunSpec) interface{} {
+				return []interface{}{spec.Config.StopSignal, spec.Config.StopTimeout}
+			},
+			expected: []interface{}{"SIGINT", &stopTimeout},
+		},
+		{
+			name: "network aliases",
+			apply: func(c *types.ContainerJSON) {
+				c.HostConfig.NetworkMode = "backend"
+				c.NetworkSettings.Networks = map[string]*network.EndpointSettings{
+					"backend": {Aliases: []string{"web", "api", "0123456789ab"}},
+				}
+			},
+			field: func(spec *RunSpec) interface{} {
+				return spec.NetworkingConfig.EndpointsConfig["backend"].Aliases
+			},
+			expected: []string{"web", "api"},
+		},
+		{
+			name:     "links",
+			apply:    func(c *types.ContainerJSON) { c.HostConfig.Links = []string{"/db:/web/database"} },
+			field:    func(spec *RunSpec) interface{} { return spec.HostConfig.Links },
+			expected: []string{"db:database"},
+		},
+		{
+			name: "expose",
+			apply: func(c *types.ContainerJSON) {
+				c.Config.ExposedPorts = nat.PortSet{"8080/tcp": {}, "53/udp": {}}
+			},
+			field:    func(spec *RunSpec) interface{} { return spec.Config.ExposedPorts },
+			expected: nat.PortSet{"8080/tcp": {}, "53/udp": {}},
+		},
+		{
+			name:     "restart no",
+			apply:    func(c *types.ContainerJSON) { c.HostConfig.RestartPolicy = container.RestartPolicy{Name: "no"} },
+			field:    func(spec *RunSpec) interface{} { return spec.HostConfig.RestartPolicy },
+			expected: container.RestartPolicy{Name: "no"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dc := &dockerContainer{}
+			inspect := `{"Id": "0123456789abcdef", "Name": "/web", "Config": {"Image": "nginx"},
+				"HostConfig": {"NetworkMode": "default"}, "NetworkSettings": {}}`
+			if err := json.Unmarshal([]byte(inspect), &dc.containerInspectData); err != nil {
+				t.Fatal(err)
+			}
+
+			c.apply(&dc.containerInspectData)
+			cmd, err := dc.ConvertToDockerCommand(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec, err := ParseDockerRunCommand(cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if field := c.field(spec); !reflect.DeepEqual(field, c.expected) {
+				t.Errorf("expected %#v, but got %#v from %s", c.expected, field, cmd)
+			}
+		})
+	}
+}
+
+func TestDockerCommandArgv(t *testing.T) {
+	dc := &dockerContainer{}
+	inspect := `{"Id": "0123456789abcdef", "Name": "/web", "Config": {"Image": "nginx"},
+		"HostConfig": {"NetworkMode": "default"}}`
+	if err := json.Unmarshal([]byte(inspect), &dc.containerInspectData); err != nil {
+		t.Fatal(err)
+	}
+
+	env := []string{"GREETING=hello world", "PRICE=$5 or ${PRICE}", `QUOTE=it's "fine"`, "MOTD=line 1\nline 2",
+		"EMPTY="}
+	cmd := []string{"sh", "-c", "echo $GREETING; sleep 1 && exit 0", "a b", "`id`"}
+	dc.containerInspectData.Config.Env = env
+	dc.containerInspectData.Config.Cmd = cmd
+
+	expected := []string{"docker", "run", "--name", "web", "-d"}
+	for _, e := range env {
+		expected = append(expected, "-e", e)
+	}
+
+	expected = append(append(expected, "nginx"), cmd...)
+	for _, multiline := range []bool{false, true} {
+		line, err := dc.ConvertToDockerCommand(&CommandOptions{Multiline: multiline})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if multiline {
+			// Shells remove escaped newlines before splitting words, which go-shellwords doesn't. No value
+			// above contains a backslash, so only line continuations are removed.
+			line = strings.Replace(line, "\\\n", "", -1)
+		}
+
+		argv, err := shellwords.Parse(line)
+		if err != nil {
+			t.Fatalf("fail to split %s: %s", line, err)
+		}
+
+		if !reflect.DeepEqual(argv, expected) {
+			t.Errorf("expected argv %q, but got %q from %s", expected, argv, line)
+		}
+	}
+}
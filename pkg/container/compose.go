@@ -0,0 +1,486 @@
+package container
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"gopkg.in/yaml.v2"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	composeFileVersion = "3.7"
+)
+
+type ComposeFile struct {
+	Version  string                     `yaml:"version"`
+	Services map[string]*ComposeService `yaml:"services"`
+	Volumes  map[string]*ComposeVolume  `yaml:"volumes,omitempty"`
+	Networks map[string]*ComposeNetwork `yaml:"networks,omitempty"`
+}
+
+// ComposeVolume and ComposeNetwork refer to existing ones so that data and connections are kept after migrating.
+type ComposeVolume struct {
+	External bool `yaml:"external,omitempty"`
+}
+
+type ComposeNetwork struct {
+	External bool `yaml:"external,omitempty"`
+}
+
+type ComposeService struct {
+	Image           string                            `yaml:"image"`
+	ContainerName   string                            `yaml:"container_name,omitempty"`
+	Hostname        string                            `yaml:"hostname,omitempty"`
+	Domainname      string                            `yaml:"domainname,omitempty"`
+	User            string                            `yaml:"user,omitempty"`
+	WorkingDir      string                            `yaml:"working_dir,omitempty"`
+	Entrypoint      []string                          `yaml:"entrypoint,omitempty"`
+	Command         []string                          `yaml:"command,omitempty"`
+	Environment     []string                          `yaml:"environment,omitempty"`
+	Labels          map[string]string                 `yaml:"labels,omitempty"`
+	Ports           []string                          `yaml:"ports,omitempty"`
+	Expose          []string                          `yaml:"expose,omitempty"`
+	Volumes         []interface{}                     `yaml:"volumes,omitempty"`
+	Tmpfs           []string                          `yaml:"tmpfs,omitempty"`
+	NetworkMode     string                            `yaml:"network_mode,omitempty"`
+	Networks        map[string]*ComposeServiceNetwork `yaml:"networks,omitempty"`
+	DNS             []string                          `yaml:"dns,omitempty"`
+	DNSSearch       []string                          `yaml:"dns_search,omitempty"`
+	ExtraHosts      []string                          `yaml:"extra_hosts,omitempty"`
+	Restart         string                            `yaml:"restart,omitempty"`
+	Healthcheck     *ComposeHealthcheck               `yaml:"healthcheck,omitempty"`
+	Deploy          *ComposeDeploy                    `yaml:"deploy,omitempty"`
+	Privileged      bool                              `yaml:"privileged,omitempty"`
+	ReadOnly        bool                              `yaml:"read_only,omitempty"`
+	Init            bool                              `yaml:"init,omitempty"`
+	CapAdd          []string                          `yaml:"cap_add,omitempty"`
+	CapDrop         []string                          `yaml:"cap_drop,omitempty"`
+	SecurityOpt     []string                          `yaml:"security_opt,omitempty"`
+	Devices         []string                          `yaml:"devices,omitempty"`
+	Sysctls         map[string]string                 `yaml:"sysctls,omitempty"`
+	Ulimits         map[string]*ComposeUlimit         `yaml:"ulimits,omitempty"`
+	Logging         *ComposeLogging                   `yaml:"logging,omitempty"`
+	Pid             string                            `yaml:"pid,omitempty"`
+	Ipc             string                            `yaml:"ipc,omitempty"`
+	ShmSize         string                            `yaml:"shm_size,omitempty"`
+	StopSignal      string                            `yaml:"stop_signal,omitempty"`
+	StopGracePeriod string                            `yaml:"stop_grace_period,omitempty"`
+	StdinOpen       bool                              `yaml:"stdin_open,omitempty"`
+	Tty             bool                              `yaml:"tty,omitempty"`
+}
+
+type ComposeServiceNetwork struct {
+	Aliases     []string `yaml:"aliases,omitempty"`
+	IPv4Address string   `yaml:"ipv4_address,omitempty"`
+	IPv6Address string   `yaml:"ipv6_address,omitempty"`
+}
+
+type ComposeHealthcheck struct {
+	Test        []string `yaml:"test,omitempty"`
+	Interval    string   `yaml:"interval,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"`
+	Retries     int      `yaml:"retries,omitempty"`
+	StartPeriod string   `yaml:"start_period,omitempty"`
+	Disable     bool     `yaml:"disable,omitempty"`
+}
+
+// ComposeDeploy is only used by docker stack or docker-compose --compatibility.
+type ComposeDeploy struct {
+	Resources ComposeResources `yaml:"resources"`
+}
+
+type ComposeResources struct {
+	Limits       *ComposeResource `yaml:"limits,omitempty"`
+	Reservations *ComposeResource `yaml:"reservations,omitempty"`
+}
+
+type ComposeResource struct {
+	CPUs   string `yaml:"cpus,omitempty"`
+	Memory string `yaml:"memory,omitempty"`
+}
+
+type ComposeUlimit struct {
+	Soft int64 `yaml:"soft"`
+	Hard int64 `yaml:"hard"`
+}
+
+type ComposeLogging struct {
+	Driver  string            `yaml:"driver,omitempty"`
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+// ComposeVolumeMount is the long syntax of service volumes.
+type ComposeVolumeMount struct {
+	Type     string                `yaml:"type"`
+	Source   string                `yaml:"source,omitempty"`
+	Target   string                `yaml:"target"`
+	ReadOnly bool                  `yaml:"read_only,omitempty"`
+	Bind     *ComposeBindOptions   `yaml:"bind,omitempty"`
+	Volume   *ComposeVolumeOptions `yaml:"volume,omitempty"`
+	Tmpfs    *ComposeTmpfsOptions  `yaml:"tmpfs,omitempty"`
+}
+
+type ComposeBindOptions struct {
+	Propagation string `yaml:"propagation,omitempty"`
+}
+
+type ComposeVolumeOptions struct {
+	NoCopy bool `yaml:"nocopy,omitempty"`
+}
+
+type ComposeTmpfsOptions struct {
+	Size int64 `yaml:"size,omitempty"`
+}
+
+// NewComposeFile converts containers to services of a compose file. Named volumes and user-defined networks are
+// declared as external ones.
+func NewComposeFile(containers []DockerContainer) (f *ComposeFile, err error) {
+	f = &ComposeFile{
+		Version:  composeFileVersion,
+		Services: make(map[string]*ComposeService),
+	}
+
+	for _, c := range containers {
+		var service *ComposeService
+		var volumes, networks []string
+		service, volumes, networks, err = c.ConvertToComposeService()
+		if err != nil {
+			err = fmt.Errorf("container %s : %s", c.Name(), err)
+			return
+		}
+
+		f.Services[c.Name()] = service
+		for _, v := range volumes {
+			if f.Volumes == nil {
+				f.Volumes = make(map[string]*ComposeVolume)
+			}
+
+			f.Volumes[v] = &ComposeVolume{External: true}
+		}
+
+		for _, n := range networks {
+			if f.Networks == nil {
+				f.Networks = make(map[string]*ComposeNetwork)
+			}
+
+			f.Networks[n] = &ComposeNetwork{External: true}
+		}
+	}
+
+	return
+}
+
+func (f *ComposeFile) Write(w io.Writer) (err error) {
+	bin, err := yaml.Marshal(f)
+	if err != nil {
+		return
+	}
+
+	_, err = w.Write(bin)
+	return
+}
+
+// ConvertToComposeService returns the service of the container as well as names of volumes and networks it refers
+// to. Settings inherited from the image are omitted.
+func (c *dockerContainer) ConvertToComposeService() (service *ComposeService, volumes, networks []string,
+	err error) {
+	config := c.containerInspectData.Config
+	hostConfig := c.containerInspectData.HostConfig
+	imageConfig := c.imageConfig()
+
+	service = &ComposeService{
+		Image:         config.Image,
+		ContainerName: c.Name(),
+		Domainname:    config.Domainname,
+		Command:       composeEscape(config.Cmd),
+		Environment:   composeEscape(utils.Diff(config.Env, imageConfig.Env)),
+		DNS:           hostConfig.DNS,
+		DNSSearch:     hostConfig.DNSSearch,
+		ExtraHosts:    hostConfig.ExtraHosts,
+		Privileged:    hostConfig.Privileged,
+		ReadOnly:      hostConfig.ReadonlyRootfs,
+		CapAdd:        hostConfig.CapAdd,
+		CapDrop:       hostConfig.CapDrop,
+		SecurityOpt:   hostConfig.SecurityOpt,
+		Sysctls:       hostConfig.Sysctls,
+		StdinOpen:     config.OpenStdin,
+		Tty:           config.Tty,
+	}
+
+	if len(c.containerInspectData.ID) < 12 || config.Hostname != c.containerInspectData.ID[:12] {
+		if !hostConfig.NetworkMode.IsHost() && !hostConfig.NetworkMode.IsContainer() {
+			service.Hostname = config.Hostname
+		}
+	}
+
+	if config.User != imageConfig.User {
+		service.User = config.User
+	}
+
+	if config.WorkingDir != imageConfig.WorkingDir {
+		service.WorkingDir = config.WorkingDir
+	}
+
+	if !utils.SliceEqual(config.Entrypoint, imageConfig.Entrypoint) {
+		service.Entrypoint = composeEscape(config.Entrypoint)
+	}
+
+	for _, k := range sortedKeys(config.Labels) {
+		if v, found := imageConfig.Labels[k]; !found || v != config.Labels[k] {
+			if service.Labels == nil {
+				service.Labels = make(map[string]string)
+			}
+
+			service.Labels[k] = strings.Replace(config.Labels[k], "$", "$$", -1)
+		}
+	}
+
+	for port, bindings := range hostConfig.PortBindings {
+		for _, binding := range bindings {
+			switch {
+			case len(binding.HostIP) > 0:
+				service.Ports = append(service.Ports, binding.HostIP+":"+binding.HostPort+":"+string(port))
+			case len(binding.HostPort) > 0:
+				service.Ports = append(service.Ports, binding.HostPort+":"+string(port))
+			default:
+				service.Ports = append(service.Ports, string(port))
+			}
+		}
+	}
+
+	sort.Strings(service.Ports)
+	for port := range config.ExposedPorts {
+		_, inImage := imageConfig.ExposedPorts[port]
+		_, published := hostConfig.PortBindings[port]
+		if !inImage && !published {
+			service.Expose = append(service.Expose, string(port))
+		}
+	}
+
+	sort.Strings(service.Expose)
+	volumes = c.appendComposeVolumes(service)
+	networks = c.appendComposeNetworks(service)
+
+	restart := hostConfig.RestartPolicy
+	if restart.MaximumRetryCount > 0 {
+		service.Restart = fmt.Sprintf("%s:%d", restart.Name, restart.MaximumRetryCount)
+	} else if len(restart.Name) > 0 {
+		service.Restart = restart.Name
+	}
+
+	if hc := config.Healthcheck; hc != nil && !healthcheckEqual(hc, imageConfig.Healthcheck) {
+		service.Healthcheck = &ComposeHealthcheck{
+			Test:        composeEscape(hc.Test),
+			Interval:    composeDuration(hc.Interval),
+			Timeout:     composeDuration(hc.Timeout),
+			Retries:     hc.Retries,
+			StartPeriod: composeDuration(hc.StartPeriod),
+		}
+
+		if len(hc.Test) > 0 && hc.Test[0] == "NONE" {
+			service.Healthcheck = &ComposeHealthcheck{Disable: true}
+		}
+	}
+
+	c.appendComposeResources(service)
+	c.appendComposeRuntime(service)
+	return
+}
+
+// composeEscape escapes $ which would be interpolated by docker-compose.
+func composeEscape(values []string) (escaped []string) {
+	for _, v := range values {
+		escaped = append(escaped, strings.Replace(v, "$", "$$", -1))
+	}
+
+	return
+}
+
+func composeDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+
+	return d.String()
+}
+
+func (c *dockerContainer) appendComposeVolumes(service *ComposeService) (volumes []string) {
+	hostConfig := c.containerInspectData.HostConfig
+	parser := newMountParser()
+	for _, bind := range hostConfig.Binds {
+		service.Volumes = append(service.Volumes, bind)
+		if mountPoint, err := parser.ParseMountRaw(bind, hostConfig.VolumeDriver); err == nil &&
+			mountPoint.Type == mount.TypeVolume && len(mountPoint.Name) > 0 {
+			volumes = append(volumes, mountPoint.Name)
+		}
+	}
+
+	for _, volume := range anonymousVolumes(&c.containerInspectData) {
+		service.Volumes = append(service.Volumes, volumeToBind(volume))
+		volumes = append(volumes, volume.Name)
+	}
+
+	for _, m := range hostConfig.Mounts {
+		long := &ComposeVolumeMount{
+			Type:     string(m.Type),
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		}
+
+		if m.BindOptions != nil && len(m.BindOptions.Propagation) > 0 {
+			long.Bind = &ComposeBindOptions{Propagation: string(m.BindOptions.Propagation)}
+		}
+
+		if m.VolumeOptions != nil && m.VolumeOptions.NoCopy {
+			long.Volume = &ComposeVolumeOptions{NoCopy: true}
+		}
+
+		if m.TmpfsOptions != nil && m.TmpfsOptions.SizeBytes > 0 {
+			long.Tmpfs = &ComposeTmpfsOptions{Size: m.TmpfsOptions.SizeBytes}
+		}
+
+		if m.Type == mount.TypeVolume && len(m.Source) > 0 {
+			volumes = append(volumes, m.Source)
+		}
+
+		service.Volumes = append(service.Volumes, long)
+	}
+
+	service.Tmpfs = tmpfsFlagValues(hostConfig)
+	return
+}
+
+func (c *dockerContainer) appendComposeNetworks(service *ComposeService) (networks []string) {
+	networkMode := c.containerInspectData.HostConfig.NetworkMode
+	switch {
+	case networkMode.IsNone(), networkMode.IsHost():
+		service.NetworkMode = string(networkMode)
+		return
+	case networkMode.IsContainer():
+		service.NetworkMode = "container:" + networkMode.ConnectedContainer()
+		return
+	}
+
+	if c.containerInspectData.NetworkSettings == nil {
+		return
+	}
+
+	for name, endpoint := range c.containerInspectData.NetworkSettings.Networks {
+		// Services are connected to the default network of the project if no network specified.
+		if name == "bridge" {
+			service.NetworkMode = "bridge"
+			continue
+		}
+
+		sn := &ComposeServiceNetwork{}
+		if endpoint != nil {
+			for _, alias := range endpoint.Aliases {
+				if len(alias) != 12 || !strings.HasPrefix(c.containerInspectData.ID, alias) {
+					sn.Aliases = append(sn.Aliases, alias)
+				}
+			}
+
+			if endpoint.IPAMConfig != nil {
+				sn.IPv4Address = endpoint.IPAMConfig.IPv4Address
+				sn.IPv6Address = endpoint.IPAMConfig.IPv6Address
+			}
+		}
+
+		if service.Networks == nil {
+			service.Networks = make(map[string]*ComposeServiceNetwork)
+		}
+
+		service.Networks[name] = sn
+		networks = append(networks, name)
+	}
+
+	// network_mode and networks can't be used together
+	if len(service.Networks) > 0 {
+		service.NetworkMode = ""
+	}
+
+	sort.Strings(networks)
+	return
+}
+
+func (c *dockerContainer) appendComposeResources(service *ComposeService) {
+	resources := c.containerInspectData.HostConfig.Resources
+	for _, d := range resources.Devices {
+		device := d.PathOnHost
+		if len(d.PathInContainer) > 0 {
+			device += ":" + d.PathInContainer
+		}
+
+		service.Devices = append(service.Devices, device)
+	}
+
+	for _, ulimit := range resources.Ulimits {
+		if service.Ulimits == nil {
+			service.Ulimits = make(map[string]*ComposeUlimit)
+		}
+
+		service.Ulimits[ulimit.Name] = &ComposeUlimit{Soft: ulimit.Soft, Hard: ulimit.Hard}
+	}
+
+	limits := &ComposeResource{}
+	if resources.NanoCPUs > 0 {
+		limits.CPUs = strconv.FormatFloat(float64(resources.NanoCPUs)/1e9, 'f', -1, 64)
+	}
+
+	if resources.Memory > 0 {
+		limits.Memory = strconv.FormatInt(resources.Memory, 10)
+	}
+
+	reservations := &ComposeResource{}
+	if resources.MemoryReservation > 0 {
+		reservations.Memory = strconv.FormatInt(resources.MemoryReservation, 10)
+	}
+
+	if *limits == (ComposeResource{}) && *reservations == (ComposeResource{}) {
+		return
+	}
+
+	service.Deploy = &ComposeDeploy{}
+	if *limits != (ComposeResource{}) {
+		service.Deploy.Resources.Limits = limits
+	}
+
+	if *reservations != (ComposeResource{}) {
+		service.Deploy.Resources.Reservations = reservations
+	}
+}
+
+func (c *dockerContainer) appendComposeRuntime(service *ComposeService) {
+	config := c.containerInspectData.Config
+	hostConfig := c.containerInspectData.HostConfig
+	if len(hostConfig.LogConfig.Type) > 0 {
+		service.Logging = &ComposeLogging{
+			Driver:  hostConfig.LogConfig.Type,
+			Options: hostConfig.LogConfig.Config,
+		}
+	}
+
+	service.Pid = string(hostConfig.PidMode)
+	if ipc := hostConfig.IpcMode; !ipc.IsEmpty() && !ipc.IsPrivate() && !ipc.IsShareable() {
+		service.Ipc = string(ipc)
+	}
+
+	if shmSize := hostConfig.ShmSize; shmSize > 0 && shmSize != defaultShmSize {
+		service.ShmSize = strconv.FormatInt(shmSize, 10)
+	}
+
+	service.Init = hostConfig.Init != nil && *hostConfig.Init
+	if config.StopSignal != c.imageConfig().StopSignal {
+		service.StopSignal = config.StopSignal
+	}
+
+	if config.StopTimeout != nil {
+		service.StopGracePeriod = (time.Duration(*config.StopTimeout) * time.Second).String()
+	}
+}
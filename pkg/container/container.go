@@ -4,43 +4,46 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/strslice"
 	"github.com/docker/docker/client"
-	"github.com/docker/docker/volume/mounts"
 	"github.com/docker/go-connections/nat"
+	"github.com/kitt1987/docker-papa/pkg/daemon"
 	"github.com/kitt1987/docker-papa/pkg/history"
 	"github.com/kitt1987/docker-papa/pkg/utils"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"sync"
 )
 
 type dockerContainer struct {
 	containerInspectData types.ContainerJSON
 	imageInspectData     types.ImageInspect
 	cli                  *client.Client
+	// restartPolicy is the policy of the original container, which is disabled while it is retired.
+	restartPolicy container.RestartPolicy
+	// output receives messages of the recreation. Messages are printed to stdout and stderr if nil.
+	output io.Writer
 }
 
 const (
 	containerRecreateHistory = "container/recreate.history"
 )
 
-func GetExistedDockerContainer(IDorName, daemon string) (c DockerContainer, err error) {
-	var cli *client.Client
-	if len(daemon) > 0 {
-		cli, err = client.NewClientWithOpts(client.WithHost(daemon), client.WithVersion("1.29"))
-	} else {
-		cli, err = client.NewClientWithOpts(client.FromEnv, client.WithVersion("1.29"))
-	}
+func newDockerClient(host string) (*client.Client, error) {
+	return daemon.NewClient(host)
+}
 
+func GetExistedDockerContainer(IDorName, daemon string) (c DockerContainer, err error) {
+	cli, err := newDockerClient(daemon)
 	if err != nil {
 		return
 	}
@@ -50,12 +53,48 @@ func GetExistedDockerContainer(IDorName, daemon string) (c DockerContainer, err
 		return
 	}
 
+	ctx := context.Background()
+	containerID, err := findContainer(ctx, cli, IDorName)
+	if err != nil {
+		return
+	}
+
+	dc, err := loadDockerContainer(ctx, cli, containerID)
+	if err != nil {
+		return
+	}
+
+	c = dc
+	return
+}
+
+func loadDockerContainer(ctx context.Context, cli *client.Client, containerID string) (c *dockerContainer,
+	err error) {
+	containerInspectData, err := cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return
+	}
+
+	imageInspectData, _, err := cli.ImageInspectWithRaw(ctx, containerInspectData.Image)
+	if err != nil {
+		return
+	}
+
+	c = &dockerContainer{
+		containerInspectData: containerInspectData,
+		imageInspectData:     imageInspectData,
+		cli:                  cli,
+	}
+
+	return
+}
+
+func findContainer(ctx context.Context, cli *client.Client, IDorName string) (containerID string, err error) {
 	idFilter := filters.NewArgs()
 	idFilter.Add("id", IDorName)
 	nameFilter := filters.NewArgs()
 	nameFilter.Add("name", IDorName)
 
-	ctx := context.Background()
 	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
 		All:     true,
 		Filters: nameFilter,
@@ -82,8 +121,17 @@ func GetExistedDockerContainer(IDorName, daemon string) (c DockerContainer, err
 	}
 
 	if len(containers) > 1 {
+		// The name filter matches substrings, so turtle also matches turtle.legacy.
+		// An exact match always wins.
 		var names []string
 		for _, c := range containers {
+			for _, name := range c.Names {
+				if name == "/"+IDorName {
+					containerID = c.ID
+					return
+				}
+			}
+
 			names = append(names, c.Names...)
 		}
 
@@ -92,26 +140,153 @@ func GetExistedDockerContainer(IDorName, daemon string) (c DockerContainer, err
 		return
 	}
 
-	containerInspectData, err := cli.ContainerInspect(ctx, containers[0].ID)
+	containerID = containers[0].ID
+	return
+}
+
+// findContainerByName returns the ID of the container named exactly name. Unlike findContainer, containers whose
+// names only contain name are never returned. An empty ID is returned if no such container.
+func findContainerByName(ctx context.Context, cli *client.Client, name string) (containerID string, err error) {
+	nameFilter := filters.NewArgs()
+	nameFilter.Add("name", name)
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: nameFilter,
+	})
+
 	if err != nil {
 		return
 	}
 
-	imageInspectData, _, err := cli.ImageInspectWithRaw(ctx, containerInspectData.Image)
+	for _, c := range containers {
+		for _, n := range c.Names {
+			if n == "/"+strings.TrimPrefix(name, "/") {
+				containerID = c.ID
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (c *dockerContainer) Name() string {
+	return strings.TrimPrefix(c.containerInspectData.Name, "/")
+}
+
+func (c *dockerContainer) Recreate(opts *RecreateOptions) (newID string, err error) {
+	c.output = opts.Output
+	// The command to recover the container must be generated before any option is applied.
+	run := c.dockerRunArgs(false)
+	run.printWarnings(c.stderr())
+	cmd := run.String(utils.ShellQuote, false)
+
+	originalName := c.containerInspectData.Name
+	if opts.DryRun {
+		err = c.dryRun(opts)
+		return
+	}
+
+	entry, err := c.recreateHistoryEntry(cmd, opts)
 	if err != nil {
 		return
 	}
 
-	c = &dockerContainer{
-		containerInspectData: containerInspectData,
-		imageInspectData:     imageInspectData,
-		cli:                  cli,
+	c.restartPolicy = c.containerInspectData.HostConfig.RestartPolicy
+	if err = c.applyRecreateOptions(opts); err != nil {
+		return
 	}
 
+	ctx := context.Background()
+	if err = c.saveFilesToKeep(ctx, opts.KeepFiles); err != nil {
+		return
+	}
+
+	fmt.Fprintln(c.stdout(), "You can recover the container by execute command")
+	fmt.Fprintln(c.stdout(), cmd)
+
+	if err = c.retire(ctx, originalName); err != nil {
+		return
+	}
+
+	created, err := c.cli.ContainerCreate(ctx, c.containerInspectData.Config, c.containerInspectData.HostConfig,
+		c.networkingConfig(), c.containerInspectData.Name)
+	if err != nil {
+		c.bringBack(ctx, originalName, "")
+		return
+	}
+
+	fmt.Fprintln(c.stdout(), "Create new container", c.containerInspectData.Name)
+
+	newID = created.ID
+	if err = c.restoreFilesToKeep(ctx, newID, opts.KeepFiles); err != nil {
+		c.bringBack(ctx, originalName, newID)
+		return
+	}
+
+	if err = c.cli.ContainerStart(ctx, newID, types.ContainerStartOptions{}); err != nil {
+		c.bringBack(ctx, originalName, newID)
+		return
+	}
+
+	fmt.Fprintln(c.stdout(), "Start container", c.containerInspectData.Name)
+
+	if opts.WaitHealthy {
+		if err = c.waitUntilHealthy(ctx, newID, opts); err != nil {
+			err = fmt.Errorf("new container failed: %s", err)
+			c.bringBack(ctx, originalName, newID)
+			return
+		}
+	}
+
+	// Only successful recreations are logged, so that rollbacks never offer a spec which failed to start.
+	if logErr := logRecreateHistory(entry); logErr != nil {
+		fmt.Fprintf(c.stderr(), "fail to log recreate history: %s\n", logErr)
+	}
+
+	fmt.Fprintf(c.stdout(), "Run \"docker-papa container --recover %s\" to get the legacy container back\n",
+		c.Name())
+
 	return
 }
 
-func (c *dockerContainer) Recreate(opts *RecreateOptions) (newID string, err error) {
+func (c *dockerContainer) stdout() io.Writer {
+	if c.output != nil {
+		return c.output
+	}
+
+	return os.Stdout
+}
+
+func (c *dockerContainer) stderr() io.Writer {
+	if c.output != nil {
+		return c.output
+	}
+
+	return os.Stderr
+}
+
+// historyLock serializes writes to the recreate history of containers recreated in parallel.
+var historyLock sync.Mutex
+
+func logRecreateHistory(entry history.Entry) (err error) {
+	historyLock.Lock()
+	defer historyLock.Unlock()
+
+	recreateHistory, err := OpenRecreateHistory()
+	if err != nil {
+		return
+	}
+
+	recreateHistory.Log(entry)
+	return recreateHistory.Close()
+}
+
+func (c *dockerContainer) applyRecreateOptions(opts *RecreateOptions) (err error) {
+	if opts.Spec != nil {
+		c.applySpec(opts.Spec)
+	}
+
 	if len(opts.Image) > 0 {
 		c.containerInspectData.Config.Image = opts.Image
 	}
@@ -122,32 +297,27 @@ func (c *dockerContainer) Recreate(opts *RecreateOptions) (newID string, err err
 
 	if len(opts.Network) > 0 {
 		c.containerInspectData.HostConfig.NetworkMode = container.NetworkMode(opts.Network)
+		// Endpoints of the former network can't be carried to the new one.
+		endpoint := c.containerInspectData.NetworkSettings.Networks[opts.Network]
+		if endpoint == nil {
+			endpoint = &network.EndpointSettings{}
+		}
+
+		c.containerInspectData.NetworkSettings.Networks = map[string]*network.EndpointSettings{
+			opts.Network: endpoint,
+		}
 	}
 
 	if opts.RenewBindings {
 		c.containerInspectData.HostConfig.Binds = []string{}
+		c.containerInspectData.HostConfig.Mounts = nil
+	} else {
+		// Anonymous volumes, e.g. ones created for VOLUME in images, are kept too.
+		preserveAnonymousVolumes(&c.containerInspectData)
 	}
 
-	c.containerInspectData.HostConfig.Binds = append(c.containerInspectData.HostConfig.Binds, opts.Bindings...)
-	mountParser := mounts.NewParser(runtime.GOOS)
-	for _, bind := range opts.Bindings {
-		var mountPoint *mounts.MountPoint
-		mountPoint, err = mountParser.ParseMountRaw(bind, c.containerInspectData.HostConfig.VolumeDriver)
-		if err != nil {
-			err = fmt.Errorf("fail to parse bind %s cuz %s", bind, err)
-			return
-		}
-
-		c.containerInspectData.HostConfig.Mounts = append(c.containerInspectData.HostConfig.Mounts, mount.Mount{
-			Type:        mount.TypeBind,
-			Source:      mountPoint.Source,
-			Target:      mountPoint.Destination,
-			ReadOnly:    !mountPoint.RW,
-			Consistency: mount.ConsistencyFull,
-			BindOptions: &mount.BindOptions{
-				Propagation: mountPoint.Propagation,
-			},
-		})
+	if err = overrideBinds(c.containerInspectData.HostConfig, opts.Bindings); err != nil {
+		return
 	}
 
 	if opts.RenewEnv {
@@ -161,6 +331,14 @@ func (c *dockerContainer) Recreate(opts *RecreateOptions) (newID string, err err
 	}
 
 	_, bindings, err := nat.ParsePortSpecs(opts.PortMapping)
+	if err != nil {
+		return
+	}
+
+	if c.containerInspectData.HostConfig.PortBindings == nil {
+		c.containerInspectData.HostConfig.PortBindings = make(nat.PortMap)
+	}
+
 	for k, v := range bindings {
 		c.containerInspectData.HostConfig.PortBindings[k] = v
 	}
@@ -175,234 +353,292 @@ func (c *dockerContainer) Recreate(opts *RecreateOptions) (newID string, err err
 		c.containerInspectData.Name = opts.Rename
 	}
 
-	const tmpFilesToKeep = `.docker-files-to-keep`
-	os.MkdirAll(tmpFilesToKeep, 0600)
-
-	for _, fileToKeep := range opts.KeepFiles {
-		replicator := func(f string) (err error) {
-			fileHash := md5.Sum([]byte(f))
-			dstFile := filepath.Join(tmpFilesToKeep, c.containerInspectData.ID+hex.EncodeToString(fileHash[:])+".tar")
-			writer, err := os.Create(dstFile)
-			if err != nil {
-				return
-			}
-
-			defer writer.Close()
-			reader, _, err := c.cli.CopyFromContainer(context.Background(), c.containerInspectData.ID, f)
-			if err != nil {
-				return
-			}
+	return
+}
 
-			defer reader.Close()
+// applySpec replaces the spec of the container except its name.
+func (c *dockerContainer) applySpec(spec *RunSpec) {
+	config := *spec.Config
+	hostConfig := *spec.HostConfig
+	c.containerInspectData.Config = &config
+	c.containerInspectData.HostConfig = &hostConfig
+
+	endpoints := make(map[string]*network.EndpointSettings)
+	if spec.NetworkingConfig != nil {
+		for name, endpoint := range spec.NetworkingConfig.EndpointsConfig {
+			endpoints[name] = endpoint
+		}
+	}
 
-			if _, err = io.Copy(writer, reader); err != nil {
-				return
-			}
+	if c.containerInspectData.NetworkSettings == nil {
+		c.containerInspectData.NetworkSettings = &types.NetworkSettings{}
+	}
 
-			return
-		}
+	c.containerInspectData.NetworkSettings.Networks = endpoints
+}
 
-		if err = replicator(fileToKeep); err != nil {
-			return
-		}
+func (c *dockerContainer) networkingConfig() *network.NetworkingConfig {
+	return &network.NetworkingConfig{
+		EndpointsConfig: c.containerInspectData.NetworkSettings.Networks,
 	}
+}
 
-	ctx := context.Background()
-	cmd, err := c.ConvertToDockerCommand()
+// dryRun applies opts and prints what would be changed without touching the daemon.
+func (c *dockerContainer) dryRun(opts *RecreateOptions) (err error) {
+	original, err := c.cloneInspectData()
 	if err != nil {
 		return
 	}
 
-	fmt.Fprintln(os.Stdout, "You can recover the container by execute command")
-	fmt.Fprintln(os.Stdout, cmd)
-
-	recreateHistory, err := history.OpenFile(containerRecreateHistory)
-	if err != nil {
+	// Anonymous volumes are kept by recreation, so they are compared as binds of the current container as well.
+	preserveAnonymousVolumes(&original)
+	if err = c.applyRecreateOptions(opts); err != nil {
 		return
 	}
 
-	recreateHistory.Log(c.containerInspectData.Name, cmd)
-	recreateHistory.Close()
+	printSpecDiff(c.stdout(), strings.TrimPrefix(original.Name, "/"),
+		diffContainerSpec(&original, &c.containerInspectData))
+	return
+}
 
-	created, err := c.cli.ContainerCreate(ctx, c.containerInspectData.Config, c.containerInspectData.HostConfig,
-		&network.NetworkingConfig{
-			EndpointsConfig: c.containerInspectData.NetworkSettings.Networks,
-		},
-		c.containerInspectData.Name)
+func (c *dockerContainer) cloneInspectData() (data types.ContainerJSON, err error) {
+	bin, err := json.Marshal(c.containerInspectData)
 	if err != nil {
 		return
 	}
 
-	fmt.Fprintln(os.Stdout, "Create new container", c.containerInspectData.Name)
-
-	for _, fileToKeep := range opts.KeepFiles {
-		replicator := func(f string) (err error) {
-			fileHash := md5.Sum([]byte(f))
-			dstFile := filepath.Join(tmpFilesToKeep, c.containerInspectData.ID+hex.EncodeToString(fileHash[:])+".tar")
-			reader, err := os.Open(dstFile)
-			if err != nil {
-				return
-			}
+	err = json.Unmarshal(bin, &data)
+	return
+}
 
-			defer reader.Close()
-			err = c.cli.CopyToContainer(context.Background(), created.ID, fileToKeep, reader, types.CopyToContainerOptions{})
-			if err != nil {
-				return
-			}
+// retire renames the original container to its name with the legacy suffix and stops it. A legacy container
+// left by a former recreation is removed first.
+func (c *dockerContainer) retire(ctx context.Context, originalName string) (err error) {
+	legacy := legacyName(originalName)
+	legacyID, err := findContainerByName(ctx, c.cli, legacy)
+	if err != nil {
+		return
+	}
 
+	if len(legacyID) > 0 && legacyID != c.containerInspectData.ID {
+		fmt.Fprintln(c.stdout(), "Remove former legacy container", legacy)
+		if err = c.cli.ContainerRemove(ctx, legacyID, types.ContainerRemoveOptions{Force: true}); err != nil {
 			return
 		}
+	}
 
-		if err = replicator(fileToKeep); err != nil {
-			return
-		}
+	if err = c.cli.ContainerRename(ctx, c.containerInspectData.ID, legacy); err != nil {
+		return
 	}
 
-	newID = created.ID
-	if err = c.cli.ContainerStart(ctx, newID, types.ContainerStartOptions{}); err != nil {
+	fmt.Fprintln(c.stdout(), "Rename container", strings.TrimPrefix(originalName, "/"), "to", legacy)
+
+	// The legacy container would be brought up along with the new one by the daemon if it restarts always.
+	if err = setRestartPolicy(ctx, c.cli, c.containerInspectData.ID, container.RestartPolicy{Name: "no"}); err != nil {
 		return
 	}
 
-	fmt.Fprintln(os.Stdout, "Start container", c.containerInspectData.Name)
+	if err = c.cli.ContainerStop(ctx, c.containerInspectData.ID, nil); err != nil {
+		return
+	}
 
+	fmt.Fprintln(c.stdout(), "Stop container", legacy)
 	return
 }
 
-func (c *dockerContainer) ConvertToDockerCommand() (cmd string, err error) {
-	cmdArray := []string{`docker run`}
-	cmdArray = append(cmdArray, `--name`, c.containerInspectData.Name[1:])
-	if c.containerInspectData.HostConfig.RestartPolicy.MaximumRetryCount > 0 {
-		cmdArray = append(cmdArray, `--restart`,
-			fmt.Sprintf(`%s:%d`, c.containerInspectData.HostConfig.RestartPolicy.Name,
-				c.containerInspectData.HostConfig.RestartPolicy.MaximumRetryCount))
-	} else {
-		cmdArray = append(cmdArray, `--restart`, c.containerInspectData.HostConfig.RestartPolicy.Name)
+// bringBack undoes retire after a failed recreation. The new container is removed if it has been created.
+func (c *dockerContainer) bringBack(ctx context.Context, originalName, newID string) {
+	if len(newID) > 0 {
+		if err := c.cli.ContainerRemove(ctx, newID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			fmt.Fprintf(c.stderr(), "fail to remove new container %s: %s\n", newID, err)
+		}
 	}
 
-	if c.containerInspectData.HostConfig.AutoRemove {
-		cmdArray = append(cmdArray, `--rm`)
+	if err := c.cli.ContainerRename(ctx, c.containerInspectData.ID, strings.TrimPrefix(originalName, "/")); err != nil {
+		fmt.Fprintf(c.stderr(), "fail to rename legacy container back to %s: %s\n", originalName, err)
+		return
 	}
 
-	if !c.containerInspectData.Config.AttachStdin && !c.containerInspectData.Config.AttachStdout &&
-		!c.containerInspectData.Config.AttachStderr {
-		cmdArray = append(cmdArray, `-d`)
-	} else {
-		if c.containerInspectData.Config.AttachStdin {
-			cmdArray = append(cmdArray, `-a stdin`)
-		}
+	if err := setRestartPolicy(ctx, c.cli, c.containerInspectData.ID, c.restartPolicy); err != nil {
+		fmt.Fprintf(c.stderr(), "fail to restore restart policy of %s: %s\n", originalName, err)
+	}
 
-		if c.containerInspectData.Config.AttachStdout {
-			cmdArray = append(cmdArray, `-a stdout`)
+	if c.containerInspectData.State != nil && c.containerInspectData.State.Running {
+		if err := c.cli.ContainerStart(ctx, c.containerInspectData.ID, types.ContainerStartOptions{}); err != nil {
+			fmt.Fprintf(c.stderr(), "fail to start container %s: %s\n", originalName, err)
+			return
 		}
+	}
 
-		if c.containerInspectData.Config.AttachStderr {
-			cmdArray = append(cmdArray, `-a stderr`)
-		}
+	fmt.Fprintln(c.stdout(), "Container", strings.TrimPrefix(originalName, "/"), "is restored")
+}
+
+const (
+	legacySuffix   = ".legacy"
+	tmpFilesToKeep = `.docker-files-to-keep`
+)
+
+func setRestartPolicy(ctx context.Context, cli *client.Client, containerID string,
+	policy container.RestartPolicy) (err error) {
+	_, err = cli.ContainerUpdate(ctx, containerID, container.UpdateConfig{RestartPolicy: policy})
+	return
+}
+
+func legacyName(name string) string {
+	return strings.TrimPrefix(name, "/") + legacySuffix
+}
+
+func keptFilePath(containerID, f string) string {
+	fileHash := md5.Sum([]byte(f))
+	return filepath.Join(tmpFilesToKeep, containerID+hex.EncodeToString(fileHash[:])+".tar")
+}
+
+func (c *dockerContainer) saveFilesToKeep(ctx context.Context, files []string) (err error) {
+	if len(files) == 0 {
+		return
 	}
 
-	if c.containerInspectData.Config.Tty {
-		cmdArray = append(cmdArray, `-t`)
+	if err = os.MkdirAll(tmpFilesToKeep, 0700); err != nil {
+		return
 	}
 
-	for port, binding := range c.containerInspectData.HostConfig.PortBindings {
-		for _, hostPort := range binding {
-			if len(hostPort.HostIP) > 0 {
-				cmdArray = append(cmdArray, fmt.Sprintf(`-p %s:%s:%s`, hostPort.HostIP, hostPort.HostPort, port))
-			} else {
-				cmdArray = append(cmdArray, fmt.Sprintf(`-p %s:%s`, hostPort.HostPort, port))
+	for _, fileToKeep := range files {
+		replicator := func(f string) (err error) {
+			writer, err := os.Create(keptFilePath(c.containerInspectData.ID, f))
+			if err != nil {
+				return
+			}
+
+			defer writer.Close()
+			reader, _, err := c.cli.CopyFromContainer(ctx, c.containerInspectData.ID, f)
+			if err != nil {
+				return
 			}
+
+			defer reader.Close()
+			_, err = io.Copy(writer, reader)
+			return
 		}
-	}
 
-	if c.containerInspectData.HostConfig.NetworkMode.IsNone() {
-		cmdArray = append(cmdArray, `--net=none`)
+		if err = replicator(fileToKeep); err != nil {
+			err = fmt.Errorf("fail to keep file %s cuz %s", fileToKeep, err)
+			return
+		}
 	}
 
-	if c.containerInspectData.HostConfig.NetworkMode.IsHost() {
-		cmdArray = append(cmdArray, `--net=host`)
-	}
+	return
+}
 
-	if c.containerInspectData.HostConfig.NetworkMode.IsUserDefined() {
-		cmdArray = append(cmdArray, `--net=`+c.containerInspectData.HostConfig.NetworkMode.UserDefined())
-	}
+func (c *dockerContainer) restoreFilesToKeep(ctx context.Context, containerID string, files []string) (err error) {
+	for _, fileToKeep := range files {
+		replicator := func(f string) (err error) {
+			reader, err := os.Open(keptFilePath(c.containerInspectData.ID, f))
+			if err != nil {
+				return
+			}
 
-	for _, dns := range c.containerInspectData.HostConfig.DNS {
-		cmdArray = append(cmdArray, `--dns`, dns)
-	}
+			defer reader.Close()
+			// The archive contains the base name of the file, so extract it into the parent directory.
+			return c.cli.CopyToContainer(ctx, containerID, path.Dir(f), reader, types.CopyToContainerOptions{})
+		}
 
-	for _, dns := range c.containerInspectData.HostConfig.DNSOptions {
-		cmdArray = append(cmdArray, `--dns-option`, dns)
+		if err = replicator(fileToKeep); err != nil {
+			err = fmt.Errorf("fail to restore file %s cuz %s", fileToKeep, err)
+			return
+		}
 	}
 
-	for _, dns := range c.containerInspectData.HostConfig.DNSSearch {
-		cmdArray = append(cmdArray, `--dns-search`, dns)
-	}
+	return
+}
 
-	for _, host := range c.containerInspectData.HostConfig.ExtraHosts {
-		cmdArray = append(cmdArray, `--add-host`, host)
+// RecoverLegacyContainer gets the legacy container left by recreation back. name is either the original name of
+// the container or the name it is renamed to. The container currently using the name, if any, is removed after
+// files in keepFiles are copied from it to the legacy one. Then the legacy container is renamed back to its original
+// name, its restart policy is restored and it is started.
+func RecoverLegacyContainer(name, daemon string, keepFiles []string) (err error) {
+	cli, err := newDockerClient(daemon)
+	if err != nil {
+		return
 	}
 
-	if c.containerInspectData.HostConfig.Privileged {
-		cmdArray = append(cmdArray, `--privileged`)
+	name = strings.TrimPrefix(name, "/")
+	if len(name) == 0 {
+		err = fmt.Errorf("container name is required")
+		return
 	}
 
-	if c.containerInspectData.HostConfig.PublishAllPorts {
-		cmdArray = append(cmdArray, `-P`)
+	record, originalName, err := lastRecreateRecord(name)
+	if err != nil {
+		return
 	}
 
-	for _, containerMount := range c.containerInspectData.Mounts {
-		if containerMount.Type != mount.TypeBind {
-			fmt.Fprintf(os.Stdout, "volume %s:%s with type %s is ignored", containerMount.Source,
-				containerMount.Destination, containerMount.Type)
-			continue
+	ctx := context.Background()
+	currentName := name
+	var legacyID string
+	if record != nil {
+		legacyID, currentName = record.LegacyID, record.Name
+		if _, err = cli.ContainerInspect(ctx, legacyID); err != nil {
+			err = fmt.Errorf("legacy container %s of %s is gone: %s", record.LegacyName, name, err)
+			return
 		}
-
-		volumeOpts := containerMount.Source + `:` + containerMount.Destination
-		var opts []string
-		if !containerMount.RW {
-			opts = append(opts, `ro`)
+	} else {
+		// Recreations logged by old versions have no legacy container in the history.
+		originalName = name
+		if legacyID, err = findContainerByName(ctx, cli, legacyName(name)); err != nil {
+			return
 		}
 
-		if len(containerMount.Propagation) > 0 {
-			opts = append(opts, string(containerMount.Propagation))
+		if len(legacyID) == 0 {
+			err = fmt.Errorf("no legacy container of %s found", name)
+			return
 		}
+	}
 
-		if len(opts) > 0 {
-			volumeOpts = volumeOpts + `:` + strings.Join(opts, `,`)
+	currentID, err := findContainer(ctx, cli, currentName)
+	if err == nil && currentID != legacyID {
+		current, err := cli.ContainerInspect(ctx, currentID)
+		if err != nil {
+			return err
 		}
 
-		cmdArray = append(cmdArray, `-v`, volumeOpts)
+		if current.Name == "/"+currentName {
+			currentContainer := &dockerContainer{
+				containerInspectData: current,
+				cli:                  cli,
+			}
+
+			if err = currentContainer.saveFilesToKeep(ctx, keepFiles); err != nil {
+				return err
+			}
+
+			if err = currentContainer.restoreFilesToKeep(ctx, legacyID, keepFiles); err != nil {
+				return err
+			}
+
+			if err = cli.ContainerRemove(ctx, currentID, types.ContainerRemoveOptions{Force: true}); err != nil {
+				return err
+			}
+
+			fmt.Fprintln(os.Stdout, "Remove container", currentName)
+		}
 	}
 
-	envs := utils.Diff(c.containerInspectData.Config.Env, c.imageInspectData.Config.Env)
-	for _, env := range envs {
-		cmdArray = append(cmdArray, `-e`, env)
+	if err = cli.ContainerRename(ctx, legacyID, originalName); err != nil {
+		return
 	}
 
-	if len(c.containerInspectData.Config.Entrypoint) > 0 &&
-		!utils.SliceEqual(
-			c.containerInspectData.Config.Entrypoint,
-			c.imageInspectData.ContainerConfig.Entrypoint,
-		) {
-		cmdArray = append(cmdArray, fmt.Sprintf(`--entrypoint='%s'`,
-			strings.Join(c.containerInspectData.Config.Entrypoint, ` `)))
+	fmt.Fprintln(os.Stdout, "Rename legacy container", legacyID, "to", originalName)
+
+	if record != nil && record.HostConfig != nil {
+		if err = setRestartPolicy(ctx, cli, legacyID, record.HostConfig.RestartPolicy); err != nil {
+			return
+		}
 	}
 
-	if c.containerInspectData.Config.Healthcheck != nil {
-		cmdArray = append(cmdArray, fmt.Sprintf(`--health-cmd='%s'`,
-			strings.Join(c.containerInspectData.Config.Healthcheck.Test, ` `)))
-		cmdArray = append(cmdArray, `--health-interval=`,
-			c.containerInspectData.Config.Healthcheck.Interval.String())
-		cmdArray = append(cmdArray, fmt.Sprintf(`--health-retries=%d`,
-			c.containerInspectData.Config.Healthcheck.Retries))
-		cmdArray = append(cmdArray, `--health-timeout=`,
-			c.containerInspectData.Config.Healthcheck.Timeout.String())
-		cmdArray = append(cmdArray, `--health-start-period=`,
-			c.containerInspectData.Config.Healthcheck.StartPeriod.String())
+	if err = cli.ContainerStart(ctx, legacyID, types.ContainerStartOptions{}); err != nil {
+		return
 	}
 
-	cmdArray = append(cmdArray, c.containerInspectData.Config.Image)
-	cmdArray = append(cmdArray, strings.Join(c.containerInspectData.Config.Cmd, ` `))
-	cmd = strings.Join(cmdArray, ` `)
+	fmt.Fprintln(os.Stdout, "Start container", originalName)
 	return
 }
@@ -0,0 +1,147 @@
+package container
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type specDiff struct {
+	Field   string
+	Removed []string
+	Added   []string
+}
+
+// diffContainerSpec compares the parts of two container specs that recreation could change. Only changed fields
+// are returned.
+func diffContainerSpec(from, to *types.ContainerJSON) (diffs []specDiff) {
+	scalar := func(field, a, b string) {
+		if a == b {
+			return
+		}
+
+		d := specDiff{Field: field}
+		if len(a) > 0 {
+			d.Removed = []string{a}
+		}
+
+		if len(b) > 0 {
+			d.Added = []string{b}
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	set := func(field string, a, b []string) {
+		d := specDiff{
+			Field:   field,
+			Removed: utils.Diff(a, b),
+			Added:   utils.Diff(b, a),
+		}
+
+		if len(d.Removed) > 0 || len(d.Added) > 0 {
+			diffs = append(diffs, d)
+		}
+	}
+
+	scalar("name", strings.TrimPrefix(from.Name, "/"), strings.TrimPrefix(to.Name, "/"))
+	scalar("image", from.Config.Image, to.Config.Image)
+	scalar("entrypoint", quoteArgs(from.Config.Entrypoint), quoteArgs(to.Config.Entrypoint))
+	scalar("cmd", quoteArgs(from.Config.Cmd), quoteArgs(to.Config.Cmd))
+	set("env", from.Config.Env, to.Config.Env)
+	set("ports", portBindingsOf(from), portBindingsOf(to))
+	set("binds", from.HostConfig.Binds, to.HostConfig.Binds)
+	set("mounts", mountsOf(from), mountsOf(to))
+	scalar("restart", restartPolicyOf(from), restartPolicyOf(to))
+	scalar("network", string(from.HostConfig.NetworkMode), string(to.HostConfig.NetworkMode))
+	set("endpoints", endpointsOf(from), endpointsOf(to))
+	return
+}
+
+func printSpecDiff(w io.Writer, name string, diffs []specDiff) {
+	if len(diffs) == 0 {
+		fmt.Fprintf(w, "No changes to container %s\n", name)
+		return
+	}
+
+	fmt.Fprintf(w, "--- %s (current)\n", name)
+	fmt.Fprintf(w, "+++ %s (recreated)\n", name)
+	for _, d := range diffs {
+		fmt.Fprintf(w, "%s:\n", d.Field)
+		for _, removed := range d.Removed {
+			fmt.Fprintf(w, "  - %s\n", removed)
+		}
+
+		for _, added := range d.Added {
+			fmt.Fprintf(w, "  + %s\n", added)
+		}
+	}
+}
+
+func quoteArgs(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+
+	quoted := make([]string, len(args))
+	for i := range args {
+		quoted[i] = strconv.Quote(args[i])
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+func portBindingsOf(c *types.ContainerJSON) (ports []string) {
+	for port, bindings := range c.HostConfig.PortBindings {
+		for _, binding := range bindings {
+			ports = append(ports, fmt.Sprintf("%s:%s->%s", binding.HostIP, binding.HostPort, port))
+		}
+	}
+
+	sort.Strings(ports)
+	return
+}
+
+func mountsOf(c *types.ContainerJSON) (mounts []string) {
+	for _, m := range c.HostConfig.Mounts {
+		desc := fmt.Sprintf("type=%s,source=%s,target=%s", m.Type, m.Source, m.Target)
+		if m.ReadOnly {
+			desc += ",readonly"
+		}
+
+		mounts = append(mounts, desc)
+	}
+
+	return
+}
+
+func restartPolicyOf(c *types.ContainerJSON) string {
+	policy := c.HostConfig.RestartPolicy
+	if policy.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%s:%d", policy.Name, policy.MaximumRetryCount)
+	}
+
+	return policy.Name
+}
+
+func endpointsOf(c *types.ContainerJSON) (endpoints []string) {
+	if c.NetworkSettings == nil {
+		return
+	}
+
+	for name, endpoint := range c.NetworkSettings.Networks {
+		desc := name
+		if endpoint != nil && len(endpoint.Aliases) > 0 {
+			desc += " aliases=" + strings.Join(endpoint.Aliases, ",")
+		}
+
+		endpoints = append(endpoints, desc)
+	}
+
+	sort.Strings(endpoints)
+	return
+}
@@ -0,0 +1,50 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestDryRunKeepsAnonymousVolumes(t *testing.T) {
+	cases := []struct {
+		name     string
+		opts     RecreateOptions
+		expected string
+	}{
+		{name: "nothing changed", opts: RecreateOptions{}, expected: "No changes to container web\n"},
+		{
+			name:     "new image",
+			opts:     RecreateOptions{Image: "nginx:2"},
+			expected: "--- web (current)\n+++ web (recreated)\nimage:\n  - nginx:1\n  + nginx:2\n",
+		},
+		{
+			name:     "renew bindings",
+			opts:     RecreateOptions{RenewBindings: true},
+			expected: "--- web (current)\n+++ web (recreated)\nbinds:\n  - 0123abcd:/data\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dc := &dockerContainer{}
+			inspect := `{"Id": "0123456789abcdef", "Name": "/web", "Config": {"Image": "nginx:1"},
+				"HostConfig": {"NetworkMode": "default"}, "NetworkSettings": {},
+				"Mounts": [{"Type": "volume", "Name": "0123abcd", "Destination": "/data", "RW": true}]}`
+			if err := json.Unmarshal([]byte(inspect), &dc.containerInspectData); err != nil {
+				t.Fatal(err)
+			}
+
+			output := &bytes.Buffer{}
+			c.opts.DryRun = true
+			c.opts.Output = output
+			if _, err := dc.Recreate(&c.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			if output.String() != c.expected {
+				t.Errorf("expected diff %q, but got %q", c.expected, output)
+			}
+		})
+	}
+}
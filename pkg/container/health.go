@@ -0,0 +1,110 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"time"
+)
+
+const (
+	healthPollInterval = time.Second
+)
+
+// healthcheckOf returns the first healthcheck defined in configs. It returns nil if none of them defines one or
+// the healthcheck is disabled.
+func healthcheckOf(configs ...*container.Config) *container.HealthConfig {
+	for _, config := range configs {
+		if config == nil || config.Healthcheck == nil {
+			continue
+		}
+
+		if len(config.Healthcheck.Test) == 0 || config.Healthcheck.Test[0] == "NONE" {
+			return nil
+		}
+
+		return config.Healthcheck
+	}
+
+	return nil
+}
+
+// waitUntilHealthy waits the container to become healthy if a healthcheck is defined. Otherwise, the container is
+// required to keep running in the grace period. An error is returned if the container becomes unhealthy, exits or
+// doesn't get healthy in time.
+func (c *dockerContainer) waitUntilHealthy(ctx context.Context, containerID string, opts *RecreateOptions) (
+	err error) {
+	// The daemon merges the healthcheck of the new image into the container config.
+	created, err := c.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return
+	}
+
+	hc := healthcheckOf(created.Config, c.imageInspectData.Config)
+	timeout := opts.GracePeriod
+	if hc != nil {
+		timeout = opts.HealthTimeout
+		fmt.Fprintln(c.stdout(), "Wait for container", containerID, "to be healthy")
+	} else {
+		fmt.Fprintln(c.stdout(), "No healthcheck defined. Wait for container", containerID, "keeping running for",
+			opts.GracePeriod)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var state *types.ContainerState
+		state, err = c.stateOf(ctx, containerID)
+		if err != nil {
+			return
+		}
+
+		if !state.Running {
+			err = fmt.Errorf("container exited with code %d", state.ExitCode)
+			return
+		}
+
+		if hc != nil && state.Health != nil {
+			switch state.Health.Status {
+			case types.Healthy:
+				fmt.Fprintln(c.stdout(), "Container", containerID, "is healthy")
+				return
+			case types.Unhealthy:
+				err = fmt.Errorf("container is unhealthy")
+				return
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if hc == nil {
+				return
+			}
+
+			err = fmt.Errorf("container doesn't get healthy in %s", timeout)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-time.After(healthPollInterval):
+		}
+	}
+}
+
+func (c *dockerContainer) stateOf(ctx context.Context, containerID string) (state *types.ContainerState,
+	err error) {
+	inspectData, err := c.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return
+	}
+
+	if inspectData.State == nil {
+		err = fmt.Errorf("no state of container %s", containerID)
+		return
+	}
+
+	state = inspectData.State
+	return
+}
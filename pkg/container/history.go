@@ -0,0 +1,248 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/kitt1987/docker-papa/pkg/history"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// RecreateRecord is the detail of a container logged in the recreate history before it is recreated.
+type RecreateRecord struct {
+	Config           *container.Config         `json:"config"`
+	HostConfig       *container.HostConfig     `json:"hostConfig"`
+	NetworkingConfig *network.NetworkingConfig `json:"networkingConfig"`
+	ImageID          string                    `json:"imageID"`
+	RepoDigests      []string                  `json:"repoDigests,omitempty"`
+	Options          *RecreateOptions          `json:"options,omitempty"`
+	// Name is the name of the new container, which differs from the key if the container is renamed.
+	Name string `json:"name,omitempty"`
+	// LegacyID and LegacyName are the original container, which is renamed and stopped after recreation.
+	LegacyID   string `json:"legacyID,omitempty"`
+	LegacyName string `json:"legacyName,omitempty"`
+}
+
+// Spec returns the spec of the container in the record to be replayed. Settings assigned by the daemon to the
+// legacy container, such as its hostname, addresses and endpoint IDs, are cleared so that they are assigned again.
+func (r *RecreateRecord) Spec() *RunSpec {
+	spec := &RunSpec{
+		Config:     r.Config,
+		HostConfig: r.HostConfig,
+	}
+
+	if r.Config != nil && isAssignedName(r.Config.Hostname, r.LegacyID) {
+		config := *r.Config
+		config.Hostname = ""
+		spec.Config = &config
+	}
+
+	if r.NetworkingConfig != nil {
+		spec.NetworkingConfig = &network.NetworkingConfig{
+			EndpointsConfig: make(map[string]*network.EndpointSettings),
+		}
+
+		for name, endpoint := range r.NetworkingConfig.EndpointsConfig {
+			settings := &network.EndpointSettings{}
+			if endpoint != nil {
+				settings.IPAMConfig = endpoint.IPAMConfig
+				settings.Links = endpoint.Links
+				settings.DriverOpts = endpoint.DriverOpts
+				for _, alias := range endpoint.Aliases {
+					if !isAssignedName(alias, r.LegacyID) {
+						settings.Aliases = append(settings.Aliases, alias)
+					}
+				}
+			}
+
+			spec.NetworkingConfig.EndpointsConfig[name] = settings
+		}
+	}
+
+	return spec
+}
+
+// isAssignedName returns whether name is the short ID of the container, which docker uses as the default hostname
+// and network alias. Records of old versions have no container ID, in which any short ID is considered.
+func isAssignedName(name, containerID string) bool {
+	if len(name) != 12 {
+		return false
+	}
+
+	if len(containerID) > 0 {
+		return strings.HasPrefix(containerID, name)
+	}
+
+	for _, r := range name {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseRecreateRecord decodes the detail of an entry in the recreate history. nil is returned for entries logged
+// by old versions which have no detail.
+func ParseRecreateRecord(entry *history.Entry) (record *RecreateRecord, err error) {
+	if len(entry.Detail) == 0 {
+		return
+	}
+
+	record = &RecreateRecord{}
+	if err = json.Unmarshal([]byte(entry.Detail), record); err != nil {
+		err = fmt.Errorf("fail to decode history of %s at %s cuz %s", entry.Key, entry.Time, err)
+	}
+
+	return
+}
+
+// CommandArguments returns arguments of the docker run command creating the container in the record, such as
+// "-e TZ=UTC". A flag and its value are kept in one argument and each argument is quoted.
+func (r *RecreateRecord) CommandArguments(name string) (args []string, err error) {
+	if r.Config == nil || r.HostConfig == nil {
+		err = ErrSpecNotRecorded
+		return
+	}
+
+	spec := r.Spec()
+	c := &dockerContainer{}
+	c.containerInspectData.ContainerJSONBase = &types.ContainerJSONBase{
+		ID:         r.LegacyID,
+		Name:       RecreateHistoryKey(name),
+		HostConfig: spec.HostConfig,
+	}
+
+	c.containerInspectData.Config = spec.Config
+	c.containerInspectData.NetworkSettings = &types.NetworkSettings{}
+	if spec.NetworkingConfig != nil {
+		c.containerInspectData.NetworkSettings.Networks = spec.NetworkingConfig.EndpointsConfig
+	}
+
+	for _, g := range c.dockerRunArgs(false).groups {
+		quoted := make([]string, len(g))
+		for i := range g {
+			quoted[i] = utils.ShellQuote(g[i])
+		}
+
+		args = append(args, strings.Join(quoted, " "))
+	}
+
+	return
+}
+
+// ErrSpecNotRecorded is returned when rolling back to an entry logged by old versions, which records only the
+// command. Such commands can't be parsed back exactly since arguments of them are joined without quoting.
+var ErrSpecNotRecorded = errors.New("the entry predates spec recording and can't be rolled back to")
+
+// RollbackSpec returns the spec to be replayed to roll back to the entry.
+func RollbackSpec(entry *history.Entry) (spec *RunSpec, err error) {
+	record, err := ParseRecreateRecord(entry)
+	if err != nil {
+		return
+	}
+
+	if record == nil || record.Config == nil || record.HostConfig == nil {
+		err = ErrSpecNotRecorded
+		return
+	}
+
+	spec = record.Spec()
+	return
+}
+
+// OpenRecreateHistory opens the history in which the container is logged before each recreation. Other processes
+// can't open it until it is closed.
+func OpenRecreateHistory() (history.File, error) {
+	return history.OpenFile(containerRecreateHistory)
+}
+
+// MigrateRecreateHistory copies the recreate history from a backend to another one.
+func MigrateRecreateHistory(from, to string) (int, error) {
+	return history.Migrate(containerRecreateHistory, from, to)
+}
+
+// RecreateHistoryKey returns the key of a container name in the recreate history.
+func RecreateHistoryKey(name string) string {
+	return "/" + strings.TrimPrefix(name, "/")
+}
+
+// RecreateHistoryName returns the container name of a key in the recreate history.
+func RecreateHistoryName(key string) string {
+	return strings.TrimPrefix(key, "/")
+}
+
+// recreateHistoryEntry returns the entry logging the container before options are applied.
+func (c *dockerContainer) recreateHistoryEntry(cmd string, opts *RecreateOptions) (entry history.Entry, err error) {
+	// Only options given by users are recorded. The spec replayed is the record itself.
+	userOpts := *opts
+	userOpts.Spec = nil
+	record := RecreateRecord{
+		Config:           c.containerInspectData.Config,
+		HostConfig:       c.containerInspectData.HostConfig,
+		NetworkingConfig: c.networkingConfig(),
+		ImageID:          c.imageInspectData.ID,
+		RepoDigests:      c.imageInspectData.RepoDigests,
+		Options:          &userOpts,
+		Name:             c.Name(),
+		LegacyID:         c.containerInspectData.ID,
+		LegacyName:       legacyName(c.containerInspectData.Name),
+	}
+
+	if len(opts.Rename) > 0 {
+		record.Name = strings.TrimPrefix(opts.Rename, "/")
+	}
+
+	detail, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	entry = history.Entry{
+		Key:     c.containerInspectData.Name,
+		Content: cmd,
+		Host:    c.cli.DaemonHost(),
+		User:    currentUser(),
+		Detail:  string(detail),
+	}
+
+	return
+}
+
+// lastRecreateRecord returns the latest record in which the container named name is recreated, or renamed to name.
+// The original name of the container is returned as well. nil is returned if no such record.
+func lastRecreateRecord(name string) (record *RecreateRecord, originalName string, err error) {
+	f, err := OpenRecreateHistory()
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+	entries := f.Entries("")
+	for i := len(entries) - 1; i >= 0; i-- {
+		r, parseErr := ParseRecreateRecord(&entries[i])
+		if parseErr != nil || r == nil || len(r.LegacyID) == 0 {
+			continue
+		}
+
+		if RecreateHistoryName(entries[i].Key) == name || r.Name == name {
+			return r, RecreateHistoryName(entries[i].Key), nil
+		}
+	}
+
+	return
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return os.Getenv("USER")
+}
@@ -0,0 +1,530 @@
+package container
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"gopkg.in/yaml.v2"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Only fields used by the exporter are defined here to avoid depending on the whole Kubernetes API.
+
+type KubeMeta struct {
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels,omitempty"`
+}
+
+type KubeDeployment struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   KubeMeta           `yaml:"metadata"`
+	Spec       KubeDeploymentSpec `yaml:"spec"`
+}
+
+type KubeDeploymentSpec struct {
+	Replicas int                 `yaml:"replicas"`
+	Selector KubeSelector        `yaml:"selector"`
+	Template KubePodTemplateSpec `yaml:"template"`
+}
+
+type KubeSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+type KubePodTemplateSpec struct {
+	Metadata KubeMeta    `yaml:"metadata"`
+	Spec     KubePodSpec `yaml:"spec"`
+}
+
+type KubePodSpec struct {
+	HostNetwork bool            `yaml:"hostNetwork,omitempty"`
+	HostPID     bool            `yaml:"hostPID,omitempty"`
+	HostIPC     bool            `yaml:"hostIPC,omitempty"`
+	Hostname    string          `yaml:"hostname,omitempty"`
+	Containers  []KubeContainer `yaml:"containers"`
+	Volumes     []KubeVolume    `yaml:"volumes,omitempty"`
+}
+
+type KubeContainer struct {
+	Name            string               `yaml:"name"`
+	Image           string               `yaml:"image"`
+	Command         []string             `yaml:"command,omitempty"`
+	Args            []string             `yaml:"args,omitempty"`
+	WorkingDir      string               `yaml:"workingDir,omitempty"`
+	Env             []KubeEnvVar         `yaml:"env,omitempty"`
+	Ports           []KubeContainerPort  `yaml:"ports,omitempty"`
+	Resources       *KubeResources       `yaml:"resources,omitempty"`
+	LivenessProbe   *KubeProbe           `yaml:"livenessProbe,omitempty"`
+	VolumeMounts    []KubeVolumeMount    `yaml:"volumeMounts,omitempty"`
+	SecurityContext *KubeSecurityContext `yaml:"securityContext,omitempty"`
+	Stdin           bool                 `yaml:"stdin,omitempty"`
+	TTY             bool                 `yaml:"tty,omitempty"`
+}
+
+type KubeEnvVar struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+type KubeContainerPort struct {
+	ContainerPort int    `yaml:"containerPort"`
+	Protocol      string `yaml:"protocol,omitempty"`
+}
+
+type KubeResources struct {
+	Limits   map[string]string `yaml:"limits,omitempty"`
+	Requests map[string]string `yaml:"requests,omitempty"`
+}
+
+type KubeProbe struct {
+	Exec                KubeExecAction `yaml:"exec"`
+	InitialDelaySeconds int            `yaml:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int            `yaml:"periodSeconds,omitempty"`
+	TimeoutSeconds      int            `yaml:"timeoutSeconds,omitempty"`
+	FailureThreshold    int            `yaml:"failureThreshold,omitempty"`
+}
+
+type KubeExecAction struct {
+	Command []string `yaml:"command"`
+}
+
+type KubeVolumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+type KubeVolume struct {
+	Name                  string                   `yaml:"name"`
+	HostPath              *KubeHostPath            `yaml:"hostPath,omitempty"`
+	PersistentVolumeClaim *KubePersistentVolumeRef `yaml:"persistentVolumeClaim,omitempty"`
+	EmptyDir              *KubeEmptyDir            `yaml:"emptyDir,omitempty"`
+}
+
+type KubeHostPath struct {
+	Path string `yaml:"path"`
+}
+
+type KubePersistentVolumeRef struct {
+	ClaimName string `yaml:"claimName"`
+	ReadOnly  bool   `yaml:"readOnly,omitempty"`
+}
+
+type KubeEmptyDir struct {
+	Medium string `yaml:"medium,omitempty"`
+}
+
+type KubeSecurityContext struct {
+	Privileged             bool              `yaml:"privileged,omitempty"`
+	ReadOnlyRootFilesystem bool              `yaml:"readOnlyRootFilesystem,omitempty"`
+	RunAsUser              *int64            `yaml:"runAsUser,omitempty"`
+	Capabilities           *KubeCapabilities `yaml:"capabilities,omitempty"`
+}
+
+type KubeCapabilities struct {
+	Add  []string `yaml:"add,omitempty"`
+	Drop []string `yaml:"drop,omitempty"`
+}
+
+type KubeService struct {
+	APIVersion string          `yaml:"apiVersion"`
+	Kind       string          `yaml:"kind"`
+	Metadata   KubeMeta        `yaml:"metadata"`
+	Spec       KubeServiceSpec `yaml:"spec"`
+}
+
+type KubeServiceSpec struct {
+	Type     string            `yaml:"type"`
+	Selector map[string]string `yaml:"selector"`
+	Ports    []KubeServicePort `yaml:"ports"`
+}
+
+type KubeServicePort struct {
+	Name       string `yaml:"name"`
+	Protocol   string `yaml:"protocol"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+}
+
+var invalidKubeNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// kubeName converts s to a valid DNS-1123 label.
+func kubeName(s string) string {
+	name := strings.Trim(invalidKubeNameChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+
+	if len(name) == 0 {
+		name = "container"
+	}
+
+	return name
+}
+
+// ConvertToKubernetesManifests returns a Deployment running the container and a Service for its published ports.
+// Settings which can't be expressed in Kubernetes or may behave differently are reported as warnings.
+func (c *dockerContainer) ConvertToKubernetesManifests() (manifests []interface{}, warnings []string, err error) {
+	config := c.containerInspectData.Config
+	hostConfig := c.containerInspectData.HostConfig
+	imageConfig := c.imageConfig()
+	name := kubeName(c.Name())
+	labels := map[string]string{"app": name}
+
+	kc := KubeContainer{
+		Name:       name,
+		Image:      config.Image,
+		WorkingDir: config.WorkingDir,
+		Stdin:      config.OpenStdin,
+		TTY:        config.Tty,
+	}
+
+	if config.WorkingDir == imageConfig.WorkingDir {
+		kc.WorkingDir = ""
+	}
+
+	// command overrides ENTRYPOINT while args overrides CMD. An empty entrypoint resets the one of the image, in
+	// which case CMD is the whole command.
+	entrypoint := config.Entrypoint
+	if len(entrypoint) == 1 && len(entrypoint[0]) == 0 {
+		entrypoint = nil
+	}
+
+	switch {
+	case len(entrypoint) == 0 && len(imageConfig.Entrypoint) > 0:
+		kc.Command = config.Cmd
+	case !utils.SliceEqual(entrypoint, imageConfig.Entrypoint):
+		kc.Command = entrypoint
+		kc.Args = config.Cmd
+	case !utils.SliceEqual(config.Cmd, imageConfig.Cmd):
+		kc.Args = config.Cmd
+	}
+
+	for _, env := range utils.Diff(config.Env, imageConfig.Env) {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+
+		kc.Env = append(kc.Env, KubeEnvVar{Name: kv[0], Value: kv[1]})
+	}
+
+	var servicePorts []KubeServicePort
+	// Names of service ports must be unique. A port published on several host IPs is served once.
+	servicePortTargets := make(map[string]nat.Port)
+	for _, port := range sortedPorts(config.ExposedPorts, hostConfig.PortBindings) {
+		protocol := strings.ToUpper(port.Proto())
+		kc.Ports = append(kc.Ports, KubeContainerPort{ContainerPort: port.Int(), Protocol: protocol})
+		for _, binding := range hostConfig.PortBindings[port] {
+			servicePort := port.Int()
+			if hostPort, err := strconv.Atoi(binding.HostPort); err == nil {
+				servicePort = hostPort
+			}
+
+			if len(binding.HostIP) > 0 {
+				warnings = append(warnings, fmt.Sprintf("port %s is bound to host IP %s, which is ignored",
+					port, binding.HostIP))
+			}
+
+			portName := fmt.Sprintf("%s-%d", strings.ToLower(protocol), servicePort)
+			if target, found := servicePortTargets[portName]; found {
+				if target != port {
+					warnings = append(warnings, fmt.Sprintf("port %d/%s of the service is already served by "+
+						"port %s, so port %s is not served", servicePort, protocol, target, port))
+				}
+
+				continue
+			}
+
+			servicePortTargets[portName] = port
+			servicePorts = append(servicePorts, KubeServicePort{
+				Name:       portName,
+				Protocol:   protocol,
+				Port:       servicePort,
+				TargetPort: port.Int(),
+			})
+		}
+	}
+
+	kc.Resources = kubeResources(hostConfig.Resources.NanoCPUs, hostConfig.Resources.Memory,
+		hostConfig.Resources.MemoryReservation)
+	if hc := config.Healthcheck; hc != nil && len(hc.Test) > 1 {
+		probe := &KubeProbe{
+			InitialDelaySeconds: int(hc.StartPeriod.Seconds()),
+			PeriodSeconds:       int(hc.Interval.Seconds()),
+			TimeoutSeconds:      int(hc.Timeout.Seconds()),
+			FailureThreshold:    hc.Retries,
+		}
+
+		if hc.Test[0] == "CMD-SHELL" {
+			probe.Exec.Command = []string{"/bin/sh", "-c", strings.Join(hc.Test[1:], " ")}
+		} else {
+			probe.Exec.Command = hc.Test[1:]
+		}
+
+		kc.LivenessProbe = probe
+	}
+
+	pod := KubePodSpec{}
+	if len(c.containerInspectData.ID) < 12 || config.Hostname != c.containerInspectData.ID[:12] {
+		if !hostConfig.NetworkMode.IsHost() && !hostConfig.NetworkMode.IsContainer() {
+			pod.Hostname = kubeName(config.Hostname)
+		}
+	}
+
+	pod.Volumes, kc.VolumeMounts, warnings = c.kubeVolumes(warnings)
+	kc.SecurityContext, warnings = c.kubeSecurityContext(warnings)
+
+	switch {
+	case hostConfig.NetworkMode.IsHost():
+		pod.HostNetwork = true
+		warnings = append(warnings, "host network is used, which makes the pod share the network of its node")
+	case hostConfig.NetworkMode.IsContainer():
+		warnings = append(warnings, "network of container "+hostConfig.NetworkMode.ConnectedContainer()+
+			" is used, which has no equivalent")
+	}
+
+	if hostConfig.PidMode.IsHost() {
+		pod.HostPID = true
+		warnings = append(warnings, "host PID namespace is used")
+	}
+
+	if hostConfig.IpcMode.IsHost() {
+		pod.HostIPC = true
+		warnings = append(warnings, "host IPC namespace is used")
+	}
+
+	if len(hostConfig.Resources.Devices) > 0 {
+		warnings = append(warnings, "devices are ignored since Kubernetes has no equivalent")
+	}
+
+	if len(hostConfig.Links) > 0 || len(hostConfig.VolumesFrom) > 0 {
+		warnings = append(warnings, "links and volumes from other containers are ignored")
+	}
+
+	if restart := hostConfig.RestartPolicy.Name; restart != "always" && restart != "unless-stopped" {
+		warnings = append(warnings, fmt.Sprintf("restart policy %q is replaced by Always of Deployments",
+			restart))
+	}
+
+	pod.Containers = []KubeContainer{kc}
+	manifests = append(manifests, &KubeDeployment{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Metadata:   KubeMeta{Name: name, Labels: labels},
+		Spec: KubeDeploymentSpec{
+			Replicas: 1,
+			Selector: KubeSelector{MatchLabels: labels},
+			Template: KubePodTemplateSpec{
+				Metadata: KubeMeta{Name: name, Labels: labels},
+				Spec:     pod,
+			},
+		},
+	})
+
+	if len(servicePorts) > 0 {
+		manifests = append(manifests, &KubeService{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Metadata:   KubeMeta{Name: name, Labels: labels},
+			Spec: KubeServiceSpec{
+				Type:     "ClusterIP",
+				Selector: labels,
+				Ports:    servicePorts,
+			},
+		})
+	}
+
+	return
+}
+
+func sortedPorts(exposed nat.PortSet, published nat.PortMap) (ports []nat.Port) {
+	found := make(map[nat.Port]bool)
+	for port := range exposed {
+		found[port] = true
+	}
+
+	for port := range published {
+		found[port] = true
+	}
+
+	for port := range found {
+		ports = append(ports, port)
+	}
+
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Int() != ports[j].Int() {
+			return ports[i].Int() < ports[j].Int()
+		}
+
+		return ports[i].Proto() < ports[j].Proto()
+	})
+
+	return
+}
+
+func kubeResources(nanoCPUs, memory, memoryReservation int64) *KubeResources {
+	resources := &KubeResources{}
+	if nanoCPUs > 0 {
+		resources.Limits = map[string]string{"cpu": strconv.FormatInt(nanoCPUs/1e6, 10) + "m"}
+	}
+
+	if memory > 0 {
+		if resources.Limits == nil {
+			resources.Limits = make(map[string]string)
+		}
+
+		resources.Limits["memory"] = strconv.FormatInt(memory, 10)
+	}
+
+	if memoryReservation > 0 {
+		resources.Requests = map[string]string{"memory": strconv.FormatInt(memoryReservation, 10)}
+	}
+
+	if resources.Limits == nil && resources.Requests == nil {
+		return nil
+	}
+
+	return resources
+}
+
+// kubeVolumes converts host paths to hostPath volumes, named volumes to PersistentVolumeClaims of the same names
+// and tmpfs to memory-backed emptyDir volumes.
+func (c *dockerContainer) kubeVolumes(warnings []string) (volumes []KubeVolume, volumeMounts []KubeVolumeMount,
+	warns []string) {
+	warns = warnings
+	hostConfig := c.containerInspectData.HostConfig
+	add := func(v KubeVolume, mountPath string, readOnly bool) {
+		v.Name = kubeName(fmt.Sprintf("vol-%d%s", len(volumes), mountPath))
+		volumes = append(volumes, v)
+		volumeMounts = append(volumeMounts, KubeVolumeMount{Name: v.Name, MountPath: mountPath, ReadOnly: readOnly})
+	}
+
+	addSource := func(typ mount.Type, source, target string, readOnly bool) {
+		switch typ {
+		case mount.TypeBind:
+			add(KubeVolume{HostPath: &KubeHostPath{Path: source}}, target, readOnly)
+			warns = append(warns, fmt.Sprintf("host path %s is mounted, which is only available on the node",
+				source))
+		case mount.TypeVolume:
+			if len(source) == 0 {
+				add(KubeVolume{EmptyDir: &KubeEmptyDir{}}, target, readOnly)
+				return
+			}
+
+			add(KubeVolume{PersistentVolumeClaim: &KubePersistentVolumeRef{ClaimName: kubeName(source)}},
+				target, readOnly)
+			warns = append(warns, fmt.Sprintf("volume %s is converted to PersistentVolumeClaim %s which "+
+				"should be created and populated manually", source, kubeName(source)))
+		case mount.TypeTmpfs:
+			add(KubeVolume{EmptyDir: &KubeEmptyDir{Medium: "Memory"}}, target, readOnly)
+		default:
+			warns = append(warns, fmt.Sprintf("mount %s of type %s is ignored", target, typ))
+		}
+	}
+
+	parser := newMountParser()
+	for _, bind := range hostConfig.Binds {
+		mountPoint, err := parser.ParseMountRaw(bind, hostConfig.VolumeDriver)
+		if err != nil {
+			warns = append(warns, fmt.Sprintf("bind %s is ignored: %s", bind, err))
+			continue
+		}
+
+		source := mountPoint.Source
+		if mountPoint.Type == mount.TypeVolume {
+			source = mountPoint.Name
+		}
+
+		addSource(mountPoint.Type, source, mountPoint.Destination, !mountPoint.RW)
+	}
+
+	for _, volume := range anonymousVolumes(&c.containerInspectData) {
+		addSource(mount.TypeVolume, volume.Name, volume.Destination, !volume.RW)
+	}
+
+	for _, m := range hostConfig.Mounts {
+		addSource(m.Type, m.Source, m.Target, m.ReadOnly)
+	}
+
+	for _, dst := range sortedKeys(hostConfig.Tmpfs) {
+		addSource(mount.TypeTmpfs, "", dst, false)
+	}
+
+	return
+}
+
+func (c *dockerContainer) kubeSecurityContext(warnings []string) (sc *KubeSecurityContext, warns []string) {
+	warns = warnings
+	config := c.containerInspectData.Config
+	hostConfig := c.containerInspectData.HostConfig
+	sc = &KubeSecurityContext{
+		Privileged:             hostConfig.Privileged,
+		ReadOnlyRootFilesystem: hostConfig.ReadonlyRootfs,
+	}
+
+	if hostConfig.Privileged {
+		warns = append(warns, "the container is privileged, which may be forbidden by pod security policies")
+	}
+
+	if user := config.User; len(user) > 0 && user != c.imageConfig().User {
+		if uid, err := strconv.ParseInt(strings.SplitN(user, ":", 2)[0], 10, 64); err == nil {
+			sc.RunAsUser = &uid
+		} else {
+			warns = append(warns, fmt.Sprintf("user %s is ignored since only numeric UIDs are supported", user))
+		}
+	}
+
+	trimCap := func(caps []string) (trimmed []string) {
+		for _, capability := range caps {
+			trimmed = append(trimmed, strings.TrimPrefix(strings.ToUpper(capability), "CAP_"))
+		}
+
+		return
+	}
+
+	if len(hostConfig.CapAdd) > 0 || len(hostConfig.CapDrop) > 0 {
+		sc.Capabilities = &KubeCapabilities{
+			Add:  trimCap(hostConfig.CapAdd),
+			Drop: trimCap(hostConfig.CapDrop),
+		}
+	}
+
+	if len(hostConfig.SecurityOpt) > 0 {
+		warns = append(warns, "security options are ignored")
+	}
+
+	if *sc == (KubeSecurityContext{}) {
+		sc = nil
+	}
+
+	return
+}
+
+// WriteKubernetesManifests writes manifests as a multi-document YAML.
+func WriteKubernetesManifests(w io.Writer, manifests []interface{}) (err error) {
+	for i, m := range manifests {
+		if i > 0 {
+			if _, err = io.WriteString(w, "---\n"); err != nil {
+				return
+			}
+		}
+
+		var bin []byte
+		if bin, err = yaml.Marshal(m); err != nil {
+			return
+		}
+
+		if _, err = w.Write(bin); err != nil {
+			return
+		}
+	}
+
+	return
+}
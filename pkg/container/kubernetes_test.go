@@ -0,0 +1,79 @@
+package container
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func convertToKubernetes(t *testing.T, inspect, image string) (deployment *KubeDeployment, service *KubeService,
+	warnings []string) {
+	dc := &dockerContainer{}
+	if err := json.Unmarshal([]byte(inspect), &dc.containerInspectData); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal([]byte(image), &dc.imageInspectData); err != nil {
+		t.Fatal(err)
+	}
+
+	manifests, warnings, err := dc.ConvertToKubernetesManifests()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployment = manifests[0].(*KubeDeployment)
+	if len(manifests) > 1 {
+		service = manifests[1].(*KubeService)
+	}
+
+	return
+}
+
+func TestKubernetesServicePorts(t *testing.T) {
+	_, service, warnings := convertToKubernetes(t, `{"Id": "0123456789abcdef", "Name": "/web",
+		"Config": {"Image": "nginx", "ExposedPorts": {"80/tcp": {}, "8080/tcp": {}}},
+		"HostConfig": {"NetworkMode": "default", "PortBindings": {
+			"80/tcp": [{"HostIp": "0.0.0.0", "HostPort": "80"}, {"HostIp": "::", "HostPort": "80"},
+				{"HostPort": "8000"}],
+			"8080/tcp": [{"HostIp": "127.0.0.1", "HostPort": "8000"}]}}}`, `{"Config": {}}`)
+
+	expected := []KubeServicePort{
+		{Name: "tcp-80", Protocol: "TCP", Port: 80, TargetPort: 80},
+		{Name: "tcp-8000", Protocol: "TCP", Port: 8000, TargetPort: 80},
+	}
+
+	if service == nil || !reflect.DeepEqual(service.Spec.Ports, expected) {
+		t.Fatalf("expected service ports %+v, but got %+v", expected, service)
+	}
+
+	if len(warnings) == 0 {
+		t.Errorf("port 8080 not served is not warned")
+	}
+}
+
+func TestKubernetesResetEntrypoint(t *testing.T) {
+	cases := []struct {
+		name    string
+		image   string
+		command []string
+		args    []string
+	}{
+		{name: "image with entrypoint", image: `{"Config": {"Entrypoint": ["/docker-entrypoint.sh"]}}`,
+			command: []string{"sh", "-c", "env"}},
+		{name: "image without entrypoint", image: `{"Config": {"Cmd": ["nginx"]}}`, args: []string{"sh", "-c", "env"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			deployment, _, _ := convertToKubernetes(t, `{"Id": "0123456789abcdef", "Name": "/web",
+				"Config": {"Image": "nginx", "Entrypoint": [""], "Cmd": ["sh", "-c", "env"]},
+				"HostConfig": {"NetworkMode": "default"}}`, c.image)
+			kc := deployment.Spec.Template.Spec.Containers[0]
+			if !reflect.DeepEqual(kc.Command, c.command) || !reflect.DeepEqual(kc.Args, c.args) {
+				t.Errorf("expected command %q and args %q, but got %q and %q", c.command, c.args, kc.Command,
+					kc.Args)
+			}
+		})
+	}
+}
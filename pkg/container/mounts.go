@@ -0,0 +1,197 @@
+package container
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/volume/mounts"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func newMountParser() mounts.Parser {
+	return mounts.NewParser(runtime.GOOS)
+}
+
+// bindDestination returns the path in container of a bind like name:/path:ro. An empty string is returned if the
+// bind is invalid.
+func bindDestination(parser mounts.Parser, bind, volumeDriver string) string {
+	mountPoint, err := parser.ParseMountRaw(bind, volumeDriver)
+	if err != nil {
+		return ""
+	}
+
+	return mountPoint.Destination
+}
+
+// explicitDestinations returns paths in container mounted by binds, mounts or tmpfs in the host config.
+func explicitDestinations(hc *container.HostConfig) map[string]bool {
+	parser := newMountParser()
+	destinations := make(map[string]bool)
+	for _, bind := range hc.Binds {
+		if dst := bindDestination(parser, bind, hc.VolumeDriver); len(dst) > 0 {
+			destinations[dst] = true
+		}
+	}
+
+	for _, m := range hc.Mounts {
+		destinations[m.Target] = true
+	}
+
+	for dst := range hc.Tmpfs {
+		destinations[dst] = true
+	}
+
+	return destinations
+}
+
+// anonymousVolumes returns volumes not specified in the host config, such as ones created for VOLUME in images.
+// They would be replaced by new empty volumes if the container is created again without them.
+func anonymousVolumes(c *types.ContainerJSON) (volumes []types.MountPoint) {
+	explicit := explicitDestinations(c.HostConfig)
+	for _, m := range c.Mounts {
+		if m.Type != mount.TypeVolume || len(m.Name) == 0 || explicit[m.Destination] {
+			continue
+		}
+
+		volumes = append(volumes, m)
+	}
+
+	return
+}
+
+// volumeToBind converts a volume to a bind like name:/path:ro.
+func volumeToBind(m types.MountPoint) string {
+	bind := m.Name + ":" + m.Destination
+	if !m.RW {
+		bind += ":ro"
+	}
+
+	return bind
+}
+
+// preserveAnonymousVolumes makes the host config refer to volumes the container is using but not specified in
+// the host config.
+func preserveAnonymousVolumes(c *types.ContainerJSON) {
+	for _, m := range anonymousVolumes(c) {
+		c.HostConfig.Binds = append(c.HostConfig.Binds, volumeToBind(m))
+	}
+}
+
+// overrideBinds appends binds to the host config. Binds and mounts at the same paths are replaced.
+func overrideBinds(hc *container.HostConfig, binds []string) (err error) {
+	parser := newMountParser()
+	for _, bind := range binds {
+		var mountPoint *mounts.MountPoint
+		mountPoint, err = parser.ParseMountRaw(bind, hc.VolumeDriver)
+		if err != nil {
+			err = fmt.Errorf("fail to parse bind %s cuz %s", bind, err)
+			return
+		}
+
+		var keptBinds []string
+		for _, existed := range hc.Binds {
+			if bindDestination(parser, existed, hc.VolumeDriver) != mountPoint.Destination {
+				keptBinds = append(keptBinds, existed)
+			}
+		}
+
+		var keptMounts []mount.Mount
+		for _, existed := range hc.Mounts {
+			if existed.Target != mountPoint.Destination {
+				keptMounts = append(keptMounts, existed)
+			}
+		}
+
+		delete(hc.Tmpfs, mountPoint.Destination)
+		hc.Binds = append(keptBinds, bind)
+		hc.Mounts = keptMounts
+	}
+
+	return
+}
+
+// mountFlagValue converts a mount to the value of --mount.
+func mountFlagValue(m mount.Mount) string {
+	opts := []string{"type=" + string(m.Type)}
+	if len(m.Source) > 0 {
+		opts = append(opts, "source="+m.Source)
+	}
+
+	opts = append(opts, "target="+m.Target)
+	if m.ReadOnly {
+		opts = append(opts, "readonly")
+	}
+
+	if len(m.Consistency) > 0 && m.Consistency != mount.ConsistencyDefault {
+		opts = append(opts, "consistency="+string(m.Consistency))
+	}
+
+	if m.BindOptions != nil && len(m.BindOptions.Propagation) > 0 {
+		opts = append(opts, "bind-propagation="+string(m.BindOptions.Propagation))
+	}
+
+	if m.VolumeOptions != nil {
+		if m.VolumeOptions.NoCopy {
+			opts = append(opts, "volume-nocopy")
+		}
+
+		for _, k := range sortedKeys(m.VolumeOptions.Labels) {
+			opts = append(opts, "volume-label="+k+"="+m.VolumeOptions.Labels[k])
+		}
+
+		if m.VolumeOptions.DriverConfig != nil {
+			if len(m.VolumeOptions.DriverConfig.Name) > 0 {
+				opts = append(opts, "volume-driver="+m.VolumeOptions.DriverConfig.Name)
+			}
+
+			for _, k := range sortedKeys(m.VolumeOptions.DriverConfig.Options) {
+				opts = append(opts, "volume-opt="+k+"="+m.VolumeOptions.DriverConfig.Options[k])
+			}
+		}
+	}
+
+	if m.TmpfsOptions != nil {
+		if m.TmpfsOptions.SizeBytes > 0 {
+			opts = append(opts, "tmpfs-size="+strconv.FormatInt(m.TmpfsOptions.SizeBytes, 10))
+		}
+
+		if m.TmpfsOptions.Mode != 0 {
+			opts = append(opts, "tmpfs-mode="+strconv.FormatUint(uint64(m.TmpfsOptions.Mode), 8))
+		}
+	}
+
+	// Values including commas must be quoted in CSV style.
+	for i := range opts {
+		if strings.ContainsAny(opts[i], `,"`) {
+			opts[i] = `"` + strings.Replace(opts[i], `"`, `""`, -1) + `"`
+		}
+	}
+
+	return strings.Join(opts, ",")
+}
+
+// tmpfsFlagValues converts tmpfs in the host config to values of --tmpfs.
+func tmpfsFlagValues(hc *container.HostConfig) (values []string) {
+	for _, dst := range sortedKeys(hc.Tmpfs) {
+		if len(hc.Tmpfs[dst]) > 0 {
+			values = append(values, dst+":"+hc.Tmpfs[dst])
+		} else {
+			values = append(values, dst)
+		}
+	}
+
+	return
+}
+
+func sortedKeys(m map[string]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return
+}
@@ -0,0 +1,678 @@
+package container
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/docker/docker/api/types/blkiodev"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"github.com/mattn/go-shellwords"
+	"github.com/spf13/pflag"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runFlags holds raw values of flags of a docker run command. Only flags generated by ConvertToDockerCommand and
+// their aliases are supported.
+type runFlags struct {
+	flags *pflag.FlagSet
+
+	name, restart                                    string
+	autoRemove, detach, interactive, tty             bool
+	attach                                           []string
+	hostname, domainname, user, workdir              string
+	groupAdd, labels, env                            []string
+	net, ip, ip6, macAddress                         string
+	networkAliases, links, dns, dnsOptions           []string
+	dnsSearch, extraHosts, publish, expose           []string
+	publishAll                                       bool
+	volumeDriver                                     string
+	volumes, mounts, tmpfs, volumesFrom, storageOpts []string
+	readOnly                                         bool
+	memory, memoryReservation, memorySwap            string
+	kernelMemory, shmSize, cpus                      string
+	memorySwappiness                                 int64
+	cpuShares, cpuPeriod, cpuQuota                   int64
+	cpuRtPeriod, cpuRtRuntime, pidsLimit             int64
+	cpusetCpus, cpusetMems, cgroupParent             string
+	blkioWeight                                      uint16
+	blkioWeightDevices, deviceReadBps                []string
+	deviceWriteBps, deviceReadIOps, deviceWriteIOps  []string
+	ulimits, devices, deviceCgroupRules              []string
+	oomKillDisable                                   bool
+	oomScoreAdj                                      int
+	privileged                                       bool
+	capAdd, capDrop, securityOpts, sysctls           []string
+	userns                                           string
+	logDriver, pid, ipc, uts, runtime, isolation     string
+	logOpts                                          []string
+	init                                             bool
+	stopSignal                                       string
+	stopTimeout                                      int
+	noHealthcheck                                    bool
+	healthCmd                                        string
+	healthRetries                                    int
+	healthInterval, healthTimeout, healthStartPeriod time.Duration
+	entrypoint                                       string
+}
+
+func newRunFlags() *runFlags {
+	f := &runFlags{flags: pflag.NewFlagSet("run", pflag.ContinueOnError)}
+	flags := f.flags
+	flags.SetInterspersed(false)
+	flags.SetOutput(ioutil.Discard)
+
+	flags.StringVar(&f.name, "name", "", "")
+	flags.StringVar(&f.restart, "restart", "", "")
+	flags.BoolVar(&f.autoRemove, "rm", false, "")
+	flags.BoolVarP(&f.detach, "detach", "d", false, "")
+	flags.StringArrayVarP(&f.attach, "attach", "a", nil, "")
+	flags.BoolVarP(&f.interactive, "interactive", "i", false, "")
+	flags.BoolVarP(&f.tty, "tty", "t", false, "")
+	flags.StringVarP(&f.hostname, "hostname", "h", "", "")
+	flags.StringVar(&f.domainname, "domainname", "", "")
+	flags.StringVarP(&f.user, "user", "u", "", "")
+	flags.StringArrayVar(&f.groupAdd, "group-add", nil, "")
+	flags.StringVarP(&f.workdir, "workdir", "w", "", "")
+	flags.StringArrayVarP(&f.labels, "label", "l", nil, "")
+	flags.StringArrayVarP(&f.env, "env", "e", nil, "")
+
+	flags.StringVar(&f.net, "net", "", "")
+	flags.StringVar(&f.net, "network", "", "")
+	flags.StringArrayVar(&f.networkAliases, "network-alias", nil, "")
+	flags.StringArrayVar(&f.networkAliases, "net-alias", nil, "")
+	flags.StringVar(&f.ip, "ip", "", "")
+	flags.StringVar(&f.ip6, "ip6", "", "")
+	flags.StringVar(&f.macAddress, "mac-address", "", "")
+	flags.StringArrayVar(&f.links, "link", nil, "")
+	flags.StringArrayVar(&f.dns, "dns", nil, "")
+	flags.StringArrayVar(&f.dnsOptions, "dns-option", nil, "")
+	flags.StringArrayVar(&f.dnsOptions, "dns-opt", nil, "")
+	flags.StringArrayVar(&f.dnsSearch, "dns-search", nil, "")
+	flags.StringArrayVar(&f.extraHosts, "add-host", nil, "")
+	flags.BoolVarP(&f.publishAll, "publish-all", "P", false, "")
+	flags.StringArrayVarP(&f.publish, "publish", "p", nil, "")
+	flags.StringArrayVar(&f.expose, "expose", nil, "")
+
+	flags.StringVar(&f.volumeDriver, "volume-driver", "", "")
+	flags.StringArrayVarP(&f.volumes, "volume", "v", nil, "")
+	flags.StringArrayVar(&f.mounts, "mount", nil, "")
+	flags.StringArrayVar(&f.tmpfs, "tmpfs", nil, "")
+	flags.StringArrayVar(&f.volumesFrom, "volumes-from", nil, "")
+	flags.BoolVar(&f.readOnly, "read-only", false, "")
+	flags.StringArrayVar(&f.storageOpts, "storage-opt", nil, "")
+
+	flags.StringVarP(&f.memory, "memory", "m", "", "")
+	flags.StringVar(&f.memoryReservation, "memory-reservation", "", "")
+	flags.StringVar(&f.memorySwap, "memory-swap", "", "")
+	flags.Int64Var(&f.memorySwappiness, "memory-swappiness", -1, "")
+	flags.StringVar(&f.kernelMemory, "kernel-memory", "", "")
+	flags.StringVar(&f.cpus, "cpus", "", "")
+	flags.Int64VarP(&f.cpuShares, "cpu-shares", "c", 0, "")
+	flags.Int64Var(&f.cpuPeriod, "cpu-period", 0, "")
+	flags.Int64Var(&f.cpuQuota, "cpu-quota", 0, "")
+	flags.Int64Var(&f.cpuRtPeriod, "cpu-rt-period", 0, "")
+	flags.Int64Var(&f.cpuRtRuntime, "cpu-rt-runtime", 0, "")
+	flags.StringVar(&f.cpusetCpus, "cpuset-cpus", "", "")
+	flags.StringVar(&f.cpusetMems, "cpuset-mems", "", "")
+	flags.Uint16Var(&f.blkioWeight, "blkio-weight", 0, "")
+	flags.StringArrayVar(&f.blkioWeightDevices, "blkio-weight-device", nil, "")
+	flags.StringArrayVar(&f.deviceReadBps, "device-read-bps", nil, "")
+	flags.StringArrayVar(&f.deviceWriteBps, "device-write-bps", nil, "")
+	flags.StringArrayVar(&f.deviceReadIOps, "device-read-iops", nil, "")
+	flags.StringArrayVar(&f.deviceWriteIOps, "device-write-iops", nil, "")
+	flags.BoolVar(&f.oomKillDisable, "oom-kill-disable", false, "")
+	flags.IntVar(&f.oomScoreAdj, "oom-score-adj", 0, "")
+	flags.Int64Var(&f.pidsLimit, "pids-limit", 0, "")
+	flags.StringVar(&f.cgroupParent, "cgroup-parent", "", "")
+	flags.StringArrayVar(&f.ulimits, "ulimit", nil, "")
+	flags.StringArrayVar(&f.devices, "device", nil, "")
+	flags.StringArrayVar(&f.deviceCgroupRules, "device-cgroup-rule", nil, "")
+	flags.StringVar(&f.shmSize, "shm-size", "", "")
+
+	flags.BoolVar(&f.privileged, "privileged", false, "")
+	flags.StringArrayVar(&f.capAdd, "cap-add", nil, "")
+	flags.StringArrayVar(&f.capDrop, "cap-drop", nil, "")
+	flags.StringArrayVar(&f.securityOpts, "security-opt", nil, "")
+	flags.StringArrayVar(&f.sysctls, "sysctl", nil, "")
+	flags.StringVar(&f.userns, "userns", "", "")
+
+	flags.StringVar(&f.logDriver, "log-driver", "", "")
+	flags.StringArrayVar(&f.logOpts, "log-opt", nil, "")
+	flags.StringVar(&f.pid, "pid", "", "")
+	flags.StringVar(&f.ipc, "ipc", "", "")
+	flags.StringVar(&f.uts, "uts", "", "")
+	flags.BoolVar(&f.init, "init", false, "")
+	flags.StringVar(&f.runtime, "runtime", "", "")
+	flags.StringVar(&f.isolation, "isolation", "", "")
+	flags.StringVar(&f.stopSignal, "stop-signal", "", "")
+	flags.IntVar(&f.stopTimeout, "stop-timeout", 0, "")
+
+	flags.BoolVar(&f.noHealthcheck, "no-healthcheck", false, "")
+	flags.StringVar(&f.healthCmd, "health-cmd", "", "")
+	flags.DurationVar(&f.healthInterval, "health-interval", 0, "")
+	flags.IntVar(&f.healthRetries, "health-retries", 0, "")
+	flags.DurationVar(&f.healthTimeout, "health-timeout", 0, "")
+	flags.DurationVar(&f.healthStartPeriod, "health-start-period", 0, "")
+	flags.StringVar(&f.entrypoint, "entrypoint", "", "")
+	return f
+}
+
+// ParseDockerRunCommand converts a docker run command, such as one generated by ConvertToDockerCommand, back to
+// the container spec. Settings omitted in the command are left empty, so that they are inherited from the image
+// when the container is created. Commands logged by old versions, in which values are not quoted, are not supported.
+func ParseDockerRunCommand(cmd string) (spec *RunSpec, err error) {
+	words, err := shellwords.Parse(cmd)
+	if err != nil {
+		err = fmt.Errorf("fail to split command %s cuz %s", cmd, err)
+		return
+	}
+
+	if len(words) < 2 || words[0] != "docker" || words[1] != "run" {
+		err = fmt.Errorf("not a docker run command: %s", cmd)
+		return
+	}
+
+	f := newRunFlags()
+	if err = f.flags.Parse(words[2:]); err != nil {
+		err = fmt.Errorf("fail to parse command %s cuz %s", cmd, err)
+		return
+	}
+
+	positional := f.flags.Args()
+	if len(positional) == 0 {
+		err = fmt.Errorf("no image found in command %s", cmd)
+		return
+	}
+
+	spec = &RunSpec{
+		Name:       f.name,
+		Config:     &container.Config{Image: positional[0]},
+		HostConfig: &container.HostConfig{},
+	}
+
+	if len(positional) > 1 {
+		spec.Config.Cmd = strslice.StrSlice(positional[1:])
+	}
+
+	for _, parse := range []func(*RunSpec) error{
+		f.parseGeneralArgs, f.parseNetworkArgs, f.parseMountArgs, f.parseResourceArgs, f.parseSecurityArgs,
+		f.parseRuntimeArgs,
+	} {
+		if err = parse(spec); err != nil {
+			err = fmt.Errorf("fail to parse command %s cuz %s", cmd, err)
+			return
+		}
+	}
+
+	return
+}
+
+func (f *runFlags) parseGeneralArgs(spec *RunSpec) (err error) {
+	config := spec.Config
+	hostConfig := spec.HostConfig
+
+	if len(f.restart) > 0 {
+		parts := strings.SplitN(f.restart, ":", 2)
+		hostConfig.RestartPolicy.Name = parts[0]
+		if len(parts) > 1 {
+			if hostConfig.RestartPolicy.MaximumRetryCount, err = strconv.Atoi(parts[1]); err != nil {
+				return fmt.Errorf("invalid restart policy %s", f.restart)
+			}
+		}
+	}
+
+	hostConfig.AutoRemove = f.autoRemove
+	switch {
+	case f.detach:
+	case len(f.attach) > 0:
+		for _, stream := range f.attach {
+			switch strings.ToLower(stream) {
+			case "stdin":
+				config.AttachStdin = true
+			case "stdout":
+				config.AttachStdout = true
+			case "stderr":
+				config.AttachStderr = true
+			default:
+				return fmt.Errorf("invalid stream %s to attach", stream)
+			}
+		}
+	default:
+		config.AttachStdout = true
+		config.AttachStderr = true
+	}
+
+	config.OpenStdin = f.interactive
+	config.StdinOnce = f.interactive && !f.detach
+	config.Tty = f.tty
+	config.Hostname = f.hostname
+	config.Domainname = f.domainname
+	config.User = f.user
+	hostConfig.GroupAdd = f.groupAdd
+	config.WorkingDir = f.workdir
+	config.Labels = keyValues(f.labels)
+	config.Env = f.env
+	return
+}
+
+func (f *runFlags) parseNetworkArgs(spec *RunSpec) (err error) {
+	config := spec.Config
+	hostConfig := spec.HostConfig
+
+	hostConfig.NetworkMode = container.NetworkMode(f.net)
+	if len(f.net) == 0 {
+		hostConfig.NetworkMode = "default"
+	}
+
+	spec.NetworkingConfig = &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{}}
+	if hostConfig.NetworkMode.IsUserDefined() {
+		endpoint := &network.EndpointSettings{Aliases: f.networkAliases}
+		if len(f.ip) > 0 || len(f.ip6) > 0 {
+			endpoint.IPAMConfig = &network.EndpointIPAMConfig{IPv4Address: f.ip, IPv6Address: f.ip6}
+		}
+
+		spec.NetworkingConfig.EndpointsConfig[f.net] = endpoint
+	}
+
+	config.MacAddress = f.macAddress
+	hostConfig.Links = f.links
+	hostConfig.DNS = f.dns
+	hostConfig.DNSOptions = f.dnsOptions
+	hostConfig.DNSSearch = f.dnsSearch
+	hostConfig.ExtraHosts = f.extraHosts
+	hostConfig.PublishAllPorts = f.publishAll
+
+	exposed, bindings, err := nat.ParsePortSpecs(f.publish)
+	if err != nil {
+		return
+	}
+
+	for _, port := range f.expose {
+		proto, portRange := nat.SplitProtoPort(port)
+		start, end, err := nat.ParsePortRange(portRange)
+		if err != nil {
+			return fmt.Errorf("invalid port %s to expose", port)
+		}
+
+		for p := start; p <= end; p++ {
+			exposed[nat.Port(fmt.Sprintf("%d/%s", p, proto))] = struct{}{}
+		}
+	}
+
+	if len(exposed) > 0 {
+		config.ExposedPorts = exposed
+	}
+
+	hostConfig.PortBindings = bindings
+	return
+}
+
+func (f *runFlags) parseMountArgs(spec *RunSpec) (err error) {
+	hostConfig := spec.HostConfig
+	hostConfig.VolumeDriver = f.volumeDriver
+	hostConfig.Binds = f.volumes
+	for _, value := range f.mounts {
+		var m mount.Mount
+		if m, err = parseMountFlagValue(value); err != nil {
+			return
+		}
+
+		hostConfig.Mounts = append(hostConfig.Mounts, m)
+	}
+
+	if len(f.tmpfs) > 0 {
+		hostConfig.Tmpfs = make(map[string]string)
+		for _, value := range f.tmpfs {
+			parts := strings.SplitN(value, ":", 2)
+			if len(parts) > 1 {
+				hostConfig.Tmpfs[parts[0]] = parts[1]
+			} else {
+				hostConfig.Tmpfs[parts[0]] = ""
+			}
+		}
+	}
+
+	hostConfig.VolumesFrom = f.volumesFrom
+	hostConfig.ReadonlyRootfs = f.readOnly
+	hostConfig.StorageOpt = keyValues(f.storageOpts)
+	return
+}
+
+// parseMountFlagValue is the reverse of mountFlagValue.
+func parseMountFlagValue(value string) (m mount.Mount, err error) {
+	fields, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		err = fmt.Errorf("invalid mount %s cuz %s", value, err)
+		return
+	}
+
+	m.Type = mount.TypeVolume
+	volumeOptions := func() *mount.VolumeOptions {
+		if m.VolumeOptions == nil {
+			m.VolumeOptions = &mount.VolumeOptions{}
+		}
+
+		return m.VolumeOptions
+	}
+
+	driverConfig := func() *mount.Driver {
+		if volumeOptions().DriverConfig == nil {
+			m.VolumeOptions.DriverConfig = &mount.Driver{}
+		}
+
+		return m.VolumeOptions.DriverConfig
+	}
+
+	tmpfsOptions := func() *mount.TmpfsOptions {
+		if m.TmpfsOptions == nil {
+			m.TmpfsOptions = &mount.TmpfsOptions{}
+		}
+
+		return m.TmpfsOptions
+	}
+
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		key, v := strings.ToLower(parts[0]), ""
+		if len(parts) > 1 {
+			v = parts[1]
+		}
+
+		switch key {
+		case "type":
+			m.Type = mount.Type(strings.ToLower(v))
+		case "source", "src":
+			m.Source = v
+		case "target", "dst", "destination":
+			m.Target = v
+		case "readonly", "ro":
+			m.ReadOnly = len(parts) == 1 || v == "1" || strings.ToLower(v) == "true"
+		case "consistency":
+			m.Consistency = mount.Consistency(v)
+		case "bind-propagation":
+			m.BindOptions = &mount.BindOptions{Propagation: mount.Propagation(v)}
+		case "volume-nocopy":
+			volumeOptions().NoCopy = len(parts) == 1 || v == "1" || strings.ToLower(v) == "true"
+		case "volume-label":
+			label := strings.SplitN(v, "=", 2)
+			if volumeOptions().Labels == nil {
+				m.VolumeOptions.Labels = make(map[string]string)
+			}
+
+			m.VolumeOptions.Labels[label[0]] = strings.Join(label[1:], "")
+		case "volume-driver":
+			driverConfig().Name = v
+		case "volume-opt":
+			opt := strings.SplitN(v, "=", 2)
+			if driverConfig().Options == nil {
+				m.VolumeOptions.DriverConfig.Options = make(map[string]string)
+			}
+
+			m.VolumeOptions.DriverConfig.Options[opt[0]] = strings.Join(opt[1:], "")
+		case "tmpfs-size":
+			if tmpfsOptions().SizeBytes, err = units.RAMInBytes(v); err != nil {
+				err = fmt.Errorf("invalid tmpfs size in mount %s", value)
+				return
+			}
+		case "tmpfs-mode":
+			var mode uint64
+			if mode, err = strconv.ParseUint(v, 8, 32); err != nil {
+				err = fmt.Errorf("invalid tmpfs mode in mount %s", value)
+				return
+			}
+
+			tmpfsOptions().Mode = os.FileMode(mode)
+		default:
+			err = fmt.Errorf("unknown option %s in mount %s", key, value)
+			return
+		}
+	}
+
+	if len(m.Target) == 0 {
+		err = fmt.Errorf("target is required in mount %s", value)
+	}
+
+	return
+}
+
+func (f *runFlags) parseResourceArgs(spec *RunSpec) (err error) {
+	resources := &spec.HostConfig.Resources
+	for _, size := range []struct {
+		value string
+		bytes *int64
+	}{
+		{f.memory, &resources.Memory},
+		{f.memoryReservation, &resources.MemoryReservation},
+		{f.kernelMemory, &resources.KernelMemory},
+		{f.shmSize, &spec.HostConfig.ShmSize},
+	} {
+		if len(size.value) == 0 {
+			continue
+		}
+
+		if *size.bytes, err = units.RAMInBytes(size.value); err != nil {
+			return fmt.Errorf("invalid size %s", size.value)
+		}
+	}
+
+	switch f.memorySwap {
+	case "":
+	case "-1":
+		resources.MemorySwap = -1
+	default:
+		if resources.MemorySwap, err = units.RAMInBytes(f.memorySwap); err != nil {
+			return fmt.Errorf("invalid size %s", f.memorySwap)
+		}
+	}
+
+	if f.flags.Changed("memory-swappiness") {
+		swappiness := f.memorySwappiness
+		resources.MemorySwappiness = &swappiness
+	}
+
+	if len(f.cpus) > 0 {
+		var cpus float64
+		if cpus, err = strconv.ParseFloat(f.cpus, 64); err != nil {
+			return fmt.Errorf("invalid cpus %s", f.cpus)
+		}
+
+		resources.NanoCPUs = int64(cpus * 1e9)
+	}
+
+	resources.CPUShares = f.cpuShares
+	resources.CPUPeriod = f.cpuPeriod
+	resources.CPUQuota = f.cpuQuota
+	resources.CPURealtimePeriod = f.cpuRtPeriod
+	resources.CPURealtimeRuntime = f.cpuRtRuntime
+	resources.CpusetCpus = f.cpusetCpus
+	resources.CpusetMems = f.cpusetMems
+	resources.BlkioWeight = f.blkioWeight
+	for _, value := range f.blkioWeightDevices {
+		parts := strings.SplitN(value, ":", 2)
+		weight, err := strconv.ParseUint(strings.Join(parts[1:], ""), 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid weight device %s", value)
+		}
+
+		resources.BlkioWeightDevice = append(resources.BlkioWeightDevice,
+			&blkiodev.WeightDevice{Path: parts[0], Weight: uint16(weight)})
+	}
+
+	for _, throttle := range []struct {
+		values  []string
+		devices *[]*blkiodev.ThrottleDevice
+		bytes   bool
+	}{
+		{f.deviceReadBps, &resources.BlkioDeviceReadBps, true},
+		{f.deviceWriteBps, &resources.BlkioDeviceWriteBps, true},
+		{f.deviceReadIOps, &resources.BlkioDeviceReadIOps, false},
+		{f.deviceWriteIOps, &resources.BlkioDeviceWriteIOps, false},
+	} {
+		for _, value := range throttle.values {
+			var device *blkiodev.ThrottleDevice
+			if device, err = parseThrottleDevice(value, throttle.bytes); err != nil {
+				return
+			}
+
+			*throttle.devices = append(*throttle.devices, device)
+		}
+	}
+
+	if f.oomKillDisable {
+		resources.OomKillDisable = &f.oomKillDisable
+	}
+
+	spec.HostConfig.OomScoreAdj = f.oomScoreAdj
+	resources.PidsLimit = f.pidsLimit
+	resources.CgroupParent = f.cgroupParent
+	for _, value := range f.ulimits {
+		var ulimit *units.Ulimit
+		if ulimit, err = units.ParseUlimit(value); err != nil {
+			return
+		}
+
+		resources.Ulimits = append(resources.Ulimits, ulimit)
+	}
+
+	for _, value := range f.devices {
+		var device container.DeviceMapping
+		if device, err = parseDevice(value); err != nil {
+			return
+		}
+
+		resources.Devices = append(resources.Devices, device)
+	}
+
+	resources.DeviceCgroupRules = f.deviceCgroupRules
+	return
+}
+
+// parseThrottleDevice parses a device with a rate like /dev/sda:1mb. The rate is a size if bytes is true.
+func parseThrottleDevice(value string, bytes bool) (device *blkiodev.ThrottleDevice, err error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		err = fmt.Errorf("invalid throttle device %s", value)
+		return
+	}
+
+	var rate int64
+	if bytes {
+		rate, err = units.RAMInBytes(parts[1])
+	} else {
+		var iops uint64
+		iops, err = strconv.ParseUint(parts[1], 10, 64)
+		rate = int64(iops)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("invalid throttle device %s", value)
+		return
+	}
+
+	device = &blkiodev.ThrottleDevice{Path: parts[0], Rate: uint64(rate)}
+	return
+}
+
+// parseDevice parses a device like /dev/sda:/dev/xvda:rwm.
+func parseDevice(value string) (device container.DeviceMapping, err error) {
+	parts := strings.Split(value, ":")
+	device.PathOnHost = parts[0]
+	device.PathInContainer = parts[0]
+	device.CgroupPermissions = "rwm"
+	switch len(parts) {
+	case 1:
+	case 2:
+		// The second part is either permissions or the path in container.
+		if strings.Trim(parts[1], "rwm") == "" && len(parts[1]) > 0 {
+			device.CgroupPermissions = parts[1]
+		} else {
+			device.PathInContainer = parts[1]
+		}
+	case 3:
+		device.PathInContainer = parts[1]
+		device.CgroupPermissions = parts[2]
+	default:
+		err = fmt.Errorf("invalid device %s", value)
+	}
+
+	return
+}
+
+func (f *runFlags) parseSecurityArgs(spec *RunSpec) (err error) {
+	hostConfig := spec.HostConfig
+	hostConfig.Privileged = f.privileged
+	hostConfig.CapAdd = f.capAdd
+	hostConfig.CapDrop = f.capDrop
+	hostConfig.SecurityOpt = f.securityOpts
+	hostConfig.Sysctls = keyValues(f.sysctls)
+	hostConfig.UsernsMode = container.UsernsMode(f.userns)
+	return
+}
+
+func (f *runFlags) parseRuntimeArgs(spec *RunSpec) (err error) {
+	config := spec.Config
+	hostConfig := spec.HostConfig
+
+	hostConfig.LogConfig.Type = f.logDriver
+	hostConfig.LogConfig.Config = keyValues(f.logOpts)
+	hostConfig.PidMode = container.PidMode(f.pid)
+	hostConfig.IpcMode = container.IpcMode(f.ipc)
+	hostConfig.UTSMode = container.UTSMode(f.uts)
+	if f.init {
+		hostConfig.Init = &f.init
+	}
+
+	hostConfig.Runtime = f.runtime
+	hostConfig.Isolation = container.Isolation(f.isolation)
+	config.StopSignal = f.stopSignal
+	if f.flags.Changed("stop-timeout") {
+		config.StopTimeout = &f.stopTimeout
+	}
+
+	switch {
+	case f.noHealthcheck:
+		config.Healthcheck = &container.HealthConfig{Test: []string{"NONE"}}
+	case len(f.healthCmd) > 0 || f.healthInterval > 0 || f.healthRetries > 0 || f.healthTimeout > 0 ||
+		f.healthStartPeriod > 0:
+		config.Healthcheck = &container.HealthConfig{
+			Interval:    f.healthInterval,
+			Timeout:     f.healthTimeout,
+			StartPeriod: f.healthStartPeriod,
+			Retries:     f.healthRetries,
+		}
+
+		if len(f.healthCmd) > 0 {
+			config.Healthcheck.Test = []string{"CMD-SHELL", f.healthCmd}
+		}
+	}
+
+	// An empty entrypoint resets the one of the image.
+	if f.flags.Changed("entrypoint") {
+		config.Entrypoint = strslice.StrSlice{f.entrypoint}
+	}
+
+	return
+}
+
+// keyValues converts values like k=v to a map. nil is returned if no value given.
+func keyValues(values []string) (m map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	m = make(map[string]string, len(values))
+	for _, v := range values {
+		parts := strings.SplitN(v, "=", 2)
+		m[parts[0]] = strings.Join(parts[1:], "")
+	}
+
+	return
+}
@@ -0,0 +1,163 @@
+package container
+
+import (
+	"encoding/json"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/kitt1987/docker-papa/pkg/history"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEntrypointRoundTrip(t *testing.T) {
+	cases := []struct {
+		name       string
+		entrypoint []string
+		cmd        []string
+	}{
+		{name: "single", entrypoint: []string{"/docker-entrypoint.sh"}, cmd: []string{"nginx", "-g", "daemon off;"}},
+		{name: "multiple", entrypoint: []string{"/bin/sh", "-c"}, cmd: []string{"echo $HOME # not a comment"}},
+		{name: "multiple without command", entrypoint: []string{"tini", "--", "/run.sh"}},
+		{name: "reset", entrypoint: []string{""}, cmd: []string{"sh"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dc := &dockerContainer{}
+			inspect := `{"Id": "0123456789abcdef", "Name": "/web", "Config": {"Image": "nginx"},
+				"HostConfig": {"NetworkMode": "default"}}`
+			if err := json.Unmarshal([]byte(inspect), &dc.containerInspectData); err != nil {
+				t.Fatal(err)
+			}
+
+			dc.containerInspectData.Config.Entrypoint = c.entrypoint
+			dc.containerInspectData.Config.Cmd = c.cmd
+			cmd, err := dc.ConvertToDockerCommand(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			spec, err := ParseDockerRunCommand(cmd)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(cmd, "# entrypoint") {
+				t.Errorf("entrypoint comment found in command %s", cmd)
+			}
+
+			// Elements of the entrypoint except the executable are moved to the command, which runs the same.
+			expected := append(append([]string{}, c.entrypoint...), c.cmd...)
+			argv := append(append([]string{}, spec.Config.Entrypoint...), spec.Config.Cmd...)
+			if !reflect.DeepEqual(argv, expected) {
+				t.Errorf("expected argv %q, but got %q from %s", expected, argv, cmd)
+			}
+
+			if spec.Config.Entrypoint[0] != c.entrypoint[0] {
+				t.Errorf("expected executable %q, but got %q from %s", c.entrypoint[0], spec.Config.Entrypoint[0], cmd)
+			}
+		})
+	}
+}
+
+func TestRecreateRecordSpec(t *testing.T) {
+	record := &RecreateRecord{
+		Config: &container.Config{Hostname: "0123456789ab", Image: "nginx",
+			Entrypoint: []string{"/bin/sh", "-c"}},
+		HostConfig: &container.HostConfig{},
+		NetworkingConfig: &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{
+			"backend": {
+				IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: "172.18.0.10"},
+				Aliases:    []string{"web", "0123456789ab"},
+				NetworkID:  "f00",
+				EndpointID: "ba4",
+				IPAddress:  "172.18.0.10",
+				MacAddress: "02:42:ac:12:00:0a",
+			},
+		}},
+		LegacyID: "0123456789abcdef",
+	}
+
+	spec := record.Spec()
+	if len(spec.Config.Hostname) > 0 {
+		t.Errorf("hostname %s assigned by docker is replayed", spec.Config.Hostname)
+	}
+
+	if !reflect.DeepEqual([]string(spec.Config.Entrypoint), []string{"/bin/sh", "-c"}) {
+		t.Errorf("expected the whole entrypoint replayed, but got %q", spec.Config.Entrypoint)
+	}
+
+	if record.Config.Hostname != "0123456789ab" {
+		t.Errorf("record is changed")
+	}
+
+	expected := &network.EndpointSettings{
+		IPAMConfig: &network.EndpointIPAMConfig{IPv4Address: "172.18.0.10"},
+		Aliases:    []string{"web"},
+	}
+
+	if endpoint := spec.NetworkingConfig.EndpointsConfig["backend"]; !reflect.DeepEqual(endpoint, expected) {
+		t.Errorf("expected endpoint %+v, but got %+v", expected, endpoint)
+	}
+
+	record.Config.Hostname = "web.local"
+	if spec = record.Spec(); spec.Config.Hostname != "web.local" {
+		t.Errorf("hostname given by users is cleared")
+	}
+}
+
+func TestRollbackSpec(t *testing.T) {
+	// A command logged by versions before specs are recorded, in which values are not quoted.
+	legacy := history.Entry{
+		Key: "/turtle",
+		Content: `docker run --name turtle --restart always -d -p 0.0.0.0:8080:80/tcp -e TZ=UTC ` +
+			`--entrypoint='/bin/sh -c' --health-cmd='CMD-SHELL curl -f localhost' --health-interval= 30s ` +
+			`--health-retries=3 --health-timeout= 5s --health-start-period= 0s turtle:1.7 nginx -g daemon off;`,
+	}
+
+	if spec, err := RollbackSpec(&legacy); err != ErrSpecNotRecorded {
+		t.Errorf("expected %q, but got spec %+v and error %v", ErrSpecNotRecorded, spec, err)
+	}
+
+	detail, err := json.Marshal(&RecreateRecord{
+		Config:     &container.Config{Image: "turtle:1.7", Cmd: []string{"nginx", "-g", "daemon off;"}},
+		HostConfig: &container.HostConfig{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := history.Entry{Key: "/turtle", Content: "docker run --name turtle turtle:1.7", Detail: string(detail)}
+	spec, err := RollbackSpec(&recorded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual([]string(spec.Config.Cmd), []string{"nginx", "-g", "daemon off;"}) {
+		t.Errorf("expected the recorded command, but got %q", spec.Config.Cmd)
+	}
+}
+
+func TestRecreateRecordCommandArguments(t *testing.T) {
+	record := &RecreateRecord{
+		Config: &container.Config{Hostname: "0123456789ab", Image: "nginx", Env: []string{"TZ=UTC"},
+			Entrypoint: []string{"/bin/sh", "-c"}, Cmd: []string{"echo a"}},
+		HostConfig: &container.HostConfig{NetworkMode: "default"},
+		LegacyID:   "0123456789abcdef",
+	}
+
+	args, err := record.CommandArguments("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"docker run", "--name web", "-d", "-e TZ=UTC", "--entrypoint /bin/sh", "nginx -c 'echo a'"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected arguments %q, but got %q", expected, args)
+	}
+
+	if _, err = (&RecreateRecord{}).CommandArguments("web"); err != ErrSpecNotRecorded {
+		t.Errorf("expected %q, but got %v", ErrSpecNotRecorded, err)
+	}
+}
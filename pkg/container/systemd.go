@@ -0,0 +1,141 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kitt1987/docker-papa/pkg/daemon"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"github.com/mitchellh/go-homedir"
+	"os"
+	"strings"
+)
+
+const (
+	defaultDockerPath = "/usr/bin/docker"
+)
+
+// ConvertToSystemdUnit returns a service unit which runs the container in the foreground. The restart policy of
+// the container is mapped to Restart= of the unit. Since services have no terminal, the container never keeps
+// stdin open or allocates a TTY.
+func (c *dockerContainer) ConvertToSystemdUnit(opts *SystemdOptions) (unit string, err error) {
+	if opts == nil {
+		opts = &SystemdOptions{}
+	}
+
+	docker := []string{defaultDockerPath}
+	if len(opts.Docker) > 0 {
+		docker[0] = opts.Docker
+	}
+
+	hostArgs, err := systemdHostArgs(opts.Host)
+	if err != nil {
+		return
+	}
+
+	docker = append(docker, hostArgs...)
+
+	dockerCmd := func(args ...string) string {
+		a := &runArgs{}
+		a.add(append(docker, args...)...)
+		return a.String(utils.SystemdQuote, false)
+	}
+
+	run := c.dockerRunArgs(true)
+	config := c.containerInspectData.Config
+	if config.OpenStdin || config.Tty {
+		run.warn("-i and -t are dropped since services have no terminal")
+		groups := run.groups[:0]
+		for _, g := range run.groups {
+			if len(g) != 1 || (g[0] != `-i` && g[0] != `-t`) {
+				groups = append(groups, g)
+			}
+		}
+
+		run.groups = groups
+	}
+
+	run.printWarnings(os.Stderr)
+	run.groups[0] = append(append([]string{}, docker...), `run`)
+	name := c.Name()
+
+	restart := c.containerInspectData.HostConfig.RestartPolicy
+	systemdRestart := "no"
+	switch restart.Name {
+	case "always", "unless-stopped":
+		systemdRestart = "always"
+	case "on-failure":
+		systemdRestart = "on-failure"
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "[Unit]")
+	fmt.Fprintf(buf, "Description=Docker container %s\n", name)
+	fmt.Fprintln(buf, "After=docker.service")
+	fmt.Fprintln(buf, "Requires=docker.service")
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "[Service]")
+	fmt.Fprintln(buf, "TimeoutStartSec=0")
+	if restart.MaximumRetryCount > 0 {
+		fmt.Fprintf(buf, "# The container was restarted at most %d times by docker\n", restart.MaximumRetryCount)
+	}
+
+	fmt.Fprintf(buf, "Restart=%s\n", systemdRestart)
+	if systemdRestart != "no" {
+		fmt.Fprintln(buf, "RestartSec=5")
+	}
+
+	// Failures of commands prefixed with "-" are ignored.
+	fmt.Fprintf(buf, "ExecStartPre=-%s\n", dockerCmd("stop", name))
+	fmt.Fprintf(buf, "ExecStartPre=-%s\n", dockerCmd("rm", name))
+	fmt.Fprintf(buf, "ExecStartPre=-%s\n", dockerCmd("pull", c.containerInspectData.Config.Image))
+	fmt.Fprintf(buf, "ExecStart=%s\n", strings.Replace(run.String(utils.SystemdQuote, opts.Multiline),
+		"\n  ", "\n    ", -1))
+	fmt.Fprintf(buf, "ExecStop=%s\n", dockerCmd("stop", name))
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "[Install]")
+	fmt.Fprintln(buf, "WantedBy=multi-user.target")
+	unit = buf.String()
+	return
+}
+
+// systemdHostArgs returns arguments of docker connecting to the host, or the daemon of the current context if host
+// is empty. TLS files of the context are used too.
+func systemdHostArgs(host string) (args []string, err error) {
+	if len(host) > 0 {
+		return []string{"-H", host}, nil
+	}
+
+	d, err := daemon.CurrentDaemon()
+	if err != nil || d == nil || len(d.Host) == 0 {
+		return
+	}
+
+	args = []string{"-H", d.Host}
+	if !d.TLS() {
+		return
+	}
+
+	if len(d.TLSCACert) > 0 {
+		args = append(args, "--tlsverify")
+	} else {
+		args = append(args, "--tls")
+	}
+
+	for _, f := range []struct {
+		flag, path string
+	}{{"--tlscacert", d.TLSCACert}, {"--tlscert", d.TLSCert}, {"--tlskey", d.TLSKey}} {
+		if len(f.path) == 0 {
+			continue
+		}
+
+		// systemd doesn't expand ~.
+		var filePath string
+		if filePath, err = homedir.Expand(f.path); err != nil {
+			return
+		}
+
+		args = append(args, f.flag, filePath)
+	}
+
+	return
+}
@@ -0,0 +1,61 @@
+package container
+
+import (
+	"encoding/json"
+	"github.com/kitt1987/docker-papa/pkg/ctx"
+	"github.com/mitchellh/go-homedir"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSystemdUnitWithoutTerminal(t *testing.T) {
+	dc := &dockerContainer{}
+	inspect := `{"Id": "0123456789abcdef", "Name": "/web", "Config": {"Image": "nginx", "OpenStdin": true,
+		"Tty": true, "Cmd": ["top", "-t"]}, "HostConfig": {"NetworkMode": "default"}}`
+	if err := json.Unmarshal([]byte(inspect), &dc.containerInspectData); err != nil {
+		t.Fatal(err)
+	}
+
+	unit, err := dc.ConvertToSystemdUnit(&SystemdOptions{Host: "tcp://docker.example.com:2375"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "ExecStart=/usr/bin/docker -H tcp://docker.example.com:2375 run --name web nginx top -t\n"
+	if !strings.Contains(unit, expected) {
+		t.Errorf("expected %q in unit %s", expected, unit)
+	}
+}
+
+func TestSystemdHostOfCurrentContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "papa-systemd")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	defer os.Setenv(ctx.ContextEnv, os.Getenv(ctx.ContextEnv))
+	defer func(cached bool) { homedir.DisableCache = cached }(homedir.DisableCache)
+	os.Setenv("HOME", dir)
+	os.Setenv(ctx.ContextEnv, "prod")
+	homedir.DisableCache = true
+
+	err = ctx.Create(&ctx.Context{Name: "prod", Registry: "registry.example.com",
+		Daemon: &ctx.Daemon{Host: "tcp://docker.example.com:2376", TLSCACert: "~/ca.pem"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := systemdHostArgs("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "-H tcp://docker.example.com:2376 --tlsverify --tlscacert " + dir + "/ca.pem"
+	if strings.Join(args, " ") != expected {
+		t.Errorf("expected arguments %q, but got %q", expected, args)
+	}
+}
@@ -1,5 +1,10 @@
 package ctx
 
+import (
+	"fmt"
+	"os"
+)
+
 func Create(context *Context) (err error) {
 	return context.Save()
 }
@@ -22,12 +27,29 @@ func Switch(context *Context, mode ContextMode) (err error) {
 	return cc.Save()
 }
 
+// Current returns the context named by the environment variable PAPA_CONTEXT, or the current one of the shell or
+// the user.
 func Current() (context *Context, err error) {
+	if name := os.Getenv(ContextEnv); len(name) > 0 {
+		if context, err = Load(name); err != nil {
+			err = fmt.Errorf("fail to load context %s in %s cuz %s", name, ContextEnv, err)
+		}
+
+		return
+	}
+
 	cc := CurrentContext{}
 	if err = cc.Load(); err != nil {
 		return
 	}
 
 	context = cc.Context
+	if context != nil && len(context.Name) > 0 {
+		// Credentials are not copied to the current context.
+		if saved, err := Load(context.Name); err == nil {
+			context.Credentials = saved.Credentials
+		}
+	}
+
 	return
 }
@@ -1,8 +1,11 @@
 package ctx
 
 import (
+	"fmt"
 	"github.com/kitt1987/docker-papa/pkg/home"
 	"path"
+	"sort"
+	"strings"
 )
 
 const (
@@ -10,9 +13,35 @@ const (
 )
 
 type Context struct {
-	Name         string `yaml:"name,omitempty"`
-	Registry     string `yaml:"registry,omitempty"`
-	RegistryName string `yaml:"registryName,omitempty"`
+	Name         string  `yaml:"name,omitempty"`
+	Registry     string  `yaml:"registry,omitempty"`
+	RegistryName string  `yaml:"registryName,omitempty"`
+	Daemon       *Daemon `yaml:"daemon,omitempty"`
+	// Credentials are used to log in to the registry. Credentials in the docker config are used if nil.
+	Credentials *Credentials `yaml:"credentials,omitempty"`
+	// InsecureRegistry allows connecting to the registry over plain HTTP if HTTPS fails.
+	InsecureRegistry bool `yaml:"insecureRegistry,omitempty"`
+}
+
+// Credentials are the username and password of a registry.
+type Credentials struct {
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+}
+
+// Daemon is the docker daemon a context connects to.
+type Daemon struct {
+	// Host is the endpoint of the daemon like unix:///var/run/docker.sock, tcp://host:2376 or ssh://user@host.
+	Host       string `yaml:"host,omitempty"`
+	TLSCACert  string `yaml:"tlsCACert,omitempty"`
+	TLSCert    string `yaml:"tlsCert,omitempty"`
+	TLSKey     string `yaml:"tlsKey,omitempty"`
+	APIVersion string `yaml:"apiVersion,omitempty"`
+}
+
+// TLS returns whether the daemon is connected with TLS.
+func (d *Daemon) TLS() bool {
+	return len(d.TLSCACert) > 0 || len(d.TLSCert) > 0 || len(d.TLSKey) > 0
 }
 
 func (c Context) Save() (err error) {
@@ -22,3 +51,47 @@ func (c Context) Save() (err error) {
 func (c *Context) Load() (err error) {
 	return home.Load().ReadYaml(path.Join(ContextDir, c.Name), c)
 }
+
+// List returns all contexts sorted by name.
+func List() (contexts []*Context, err error) {
+	names, err := home.Load().ReadDir(ContextDir)
+	if err != nil {
+		return
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		var c *Context
+		if c, err = Load(name); err != nil {
+			err = fmt.Errorf("fail to load context %s cuz %s", name, err)
+			return
+		}
+
+		contexts = append(contexts, c)
+	}
+
+	return
+}
+
+// Purge removes the context.
+func Purge(name string) (err error) {
+	if err = validateName(name); err != nil {
+		return
+	}
+
+	if _, err = Load(name); err != nil {
+		err = fmt.Errorf("context %s not found", name)
+		return
+	}
+
+	return home.Load().Remove(path.Join(ContextDir, name))
+}
+
+// validateName checks whether the name could be used as a file name of contexts.
+func validateName(name string) error {
+	if len(name) == 0 || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid context name %s", name)
+	}
+
+	return nil
+}
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"github.com/kitt1987/docker-papa/pkg/home"
 	"github.com/kitt1987/docker-papa/pkg/utils"
+	"github.com/mitchellh/go-homedir"
+	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 )
 
 type ContextMode string
@@ -16,23 +20,44 @@ const (
 	CurrentContextFile                   = "context"
 	GlobalCurrentContextFile             = "papa-context"
 	ContextRegistry                      = "registry.context"
+	// ContextEnv overrides the current context by name.
+	ContextEnv = "PAPA_CONTEXT"
+
+	xdgRuntimeDirEnv = "XDG_RUNTIME_DIR"
+	shellContextHome = "~/.papa/shells"
 )
 
+// CurrentContext is the context in use. In the single-user mode, it is shared by all shells of the user. In the
+// multi-user mode, it is kept in a file named by the PID of the shell in a directory only the user can access, so
+// that it is only used in the shell.
 type CurrentContext struct {
 	*Context `yaml:"inline"`
 	CtxMode  ContextMode `yaml:"contextMode,omitempty"`
 }
 
 func (c CurrentContext) Save() (err error) {
+	// Credentials are only kept in the context itself and loaded by name when used.
+	if c.Context != nil && c.Credentials != nil {
+		copied := *c.Context
+		copied.Credentials = nil
+		c.Context = &copied
+	}
+
 	switch c.CtxMode {
 	case MultipleUserContext:
-		err = utils.WriteYaml(getCtxFilePathInMultiUserMode(), &c)
-		if err != nil {
+		PurgeStaleShellContexts()
+		var filePath string
+		if filePath, err = getCtxFilePathInMultiUserMode(); err != nil {
 			return
 		}
 
-		fallthrough
+		return utils.WritePrivateYaml(filePath, &c)
 	case SingleUserContext:
+		// The context of the shell would shadow the one switched to.
+		if err = removeShellContext(); err != nil {
+			return
+		}
+
 		return home.Load().WriteYaml(CurrentContextFile, &c)
 	default:
 		err = fmt.Errorf("only single-user or multi-user is supported")
@@ -41,19 +66,99 @@ func (c CurrentContext) Save() (err error) {
 	return
 }
 
+// Load loads the context of the shell, or the one of the user if the shell has no context.
 func (c *CurrentContext) Load() (err error) {
-	err = home.Load().ReadYaml(CurrentContextFile, c)
+	filePath, err := getCtxFilePathInMultiUserMode()
+	if err != nil {
+		return
+	}
+
+	err = utils.ReadYaml(filePath, c)
+	if !os.IsNotExist(err) {
+		return
+	}
+
+	return home.Load().ReadYaml(CurrentContextFile, c)
+}
+
+// Reset makes no context current.
+func Reset() (err error) {
+	if err = removeShellContext(); err != nil {
+		return
+	}
+
+	return home.Load().Remove(CurrentContextFile)
+}
+
+func removeShellContext() (err error) {
+	filePath, err := getCtxFilePathInMultiUserMode()
+	if err != nil {
+		return
+	}
+
+	if err = os.Remove(filePath); os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
+
+// PurgeStaleShellContexts removes contexts of shells which have exited.
+func PurgeStaleShellContexts() (purged []string) {
+	dir, err := shellContextDir()
+	if err != nil {
+		return
+	}
+
+	files, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return
 	}
 
-	if c.CtxMode != MultipleUserContext {
+	prefix := GlobalCurrentContextFile + "."
+	for _, f := range files {
+		if f.IsDir() || !strings.HasPrefix(f.Name(), prefix) {
+			continue
+		}
+
+		pid, err := strconv.Atoi(strings.TrimPrefix(f.Name(), prefix))
+		if err != nil || processAlive(pid) {
+			continue
+		}
+
+		filePath := path.Join(dir, f.Name())
+		if err = os.Remove(filePath); err == nil {
+			purged = append(purged, filePath)
+		}
+	}
+
+	return
+}
+
+// shellContextDir returns the directory of contexts of shells, which only the user can access. It is in
+// $XDG_RUNTIME_DIR if set, or in the papa home otherwise.
+func shellContextDir() (dir string, err error) {
+	if runtimeDir := os.Getenv(xdgRuntimeDirEnv); len(runtimeDir) > 0 {
+		dir = path.Join(runtimeDir, "papa")
+	} else if dir, err = homedir.Expand(shellContextHome); err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(dir, 0700); err != nil {
 		return
 	}
 
-	return utils.ReadYaml(getCtxFilePathInMultiUserMode(), c)
+	// The directory may be created by former versions with a looser mode.
+	err = os.Chmod(dir, 0700)
+	return
 }
 
-func getCtxFilePathInMultiUserMode() string {
-	return path.Join(os.TempDir(), fmt.Sprintf("%s.%d", GlobalCurrentContextFile, os.Getppid()))
+func getCtxFilePathInMultiUserMode() (filePath string, err error) {
+	dir, err := shellContextDir()
+	if err != nil {
+		return
+	}
+
+	filePath = path.Join(dir, fmt.Sprintf("%s.%d", GlobalCurrentContextFile, os.Getppid()))
+	return
 }
@@ -0,0 +1,199 @@
+package ctx
+
+import (
+	"fmt"
+	"github.com/kitt1987/docker-papa/pkg/home"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+)
+
+// PortableVersion is the schema version of exported contexts.
+const PortableVersion = 1
+
+// portableContext is a context shared as a single file.
+type portableContext struct {
+	Version int `yaml:"version"`
+	Context `yaml:",inline"`
+	// Certificates are TLS files of the daemon, which are embedded since paths are only valid on the local host.
+	Certificates *portableCertificates `yaml:"certificates,omitempty"`
+}
+
+// portableCertificates are contents of TLS files in PEM.
+type portableCertificates struct {
+	CA   string `yaml:"ca,omitempty"`
+	Cert string `yaml:"cert,omitempty"`
+	Key  string `yaml:"key,omitempty"`
+}
+
+// certificateDir is where TLS files of imported contexts are saved.
+const certificateDir = "certs"
+
+// Export writes the context in a portable file. TLS files of the daemon are embedded. TLS client certificates and
+// keys, passwords in the daemon host and the registry password are removed unless includeSecrets is true.
+func Export(name string, w io.Writer, includeSecrets bool) (err error) {
+	c, err := Load(name)
+	if err != nil {
+		return
+	}
+
+	pc := portableContext{Version: PortableVersion, Context: *c}
+	if c.Daemon != nil {
+		d := *c.Daemon
+		if !includeSecrets {
+			d.TLSCert = ""
+			d.TLSKey = ""
+			if u, err := url.Parse(d.Host); err == nil && u.User != nil {
+				if _, found := u.User.Password(); found {
+					u.User = url.User(u.User.Username())
+					d.Host = u.String()
+				}
+			}
+		}
+
+		if pc.Certificates, err = embedCertificates(&d); err != nil {
+			return
+		}
+
+		pc.Daemon = &d
+	}
+
+	if !includeSecrets && c.Credentials != nil {
+		pc.Credentials = &Credentials{Username: c.Credentials.Username}
+	}
+
+	return yaml.NewEncoder(w).Encode(&pc)
+}
+
+// Import reads a context exported by Export and saves it. The name in the file is replaced if name is not empty.
+// An existing context is only overwritten if overwrite is true.
+func Import(r io.Reader, name string, overwrite bool) (c *Context, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	var header struct {
+		Version int `yaml:"version"`
+	}
+
+	if err = yaml.Unmarshal(data, &header); err != nil {
+		err = fmt.Errorf("invalid context file cuz %s", err)
+		return
+	}
+
+	if header.Version != PortableVersion {
+		err = fmt.Errorf("context file of version %d is not supported. only version %d is supported",
+			header.Version, PortableVersion)
+		return
+	}
+
+	pc := portableContext{}
+	if err = yaml.UnmarshalStrict(data, &pc); err != nil {
+		err = fmt.Errorf("invalid context file cuz %s", err)
+		return
+	}
+
+	if len(name) > 0 {
+		pc.Name = name
+	}
+
+	if err = validateName(pc.Name); err != nil {
+		return
+	}
+
+	if len(pc.Registry) == 0 {
+		err = fmt.Errorf("no registry found in context %s", pc.Name)
+		return
+	}
+
+	if len(pc.RegistryName) == 0 {
+		pc.RegistryName = ContextRegistry
+	}
+
+	if !overwrite {
+		if _, err = Load(pc.Name); err == nil {
+			err = fmt.Errorf("context %s already exists", pc.Name)
+			return
+		}
+	}
+
+	if pc.Certificates != nil {
+		if pc.Daemon == nil {
+			err = fmt.Errorf("certificates found in context %s without a daemon", pc.Name)
+			return
+		}
+
+		if err = saveCertificates(pc.Name, pc.Daemon, pc.Certificates); err != nil {
+			return
+		}
+	}
+
+	c = &pc.Context
+	err = Create(c)
+	return
+}
+
+// embedCertificates reads TLS files of the daemon and clears their paths.
+func embedCertificates(d *Daemon) (certs *portableCertificates, err error) {
+	if !d.TLS() {
+		return
+	}
+
+	certs = &portableCertificates{}
+	for _, f := range []struct {
+		path    *string
+		content *string
+	}{{&d.TLSCACert, &certs.CA}, {&d.TLSCert, &certs.Cert}, {&d.TLSKey, &certs.Key}} {
+		if len(*f.path) == 0 {
+			continue
+		}
+
+		var filePath string
+		if filePath, err = homedir.Expand(*f.path); err != nil {
+			return
+		}
+
+		var content []byte
+		if content, err = ioutil.ReadFile(filePath); err != nil {
+			err = fmt.Errorf("fail to embed TLS file %s cuz %s", *f.path, err)
+			return
+		}
+
+		*f.content = string(content)
+		*f.path = ""
+	}
+
+	return
+}
+
+// saveCertificates writes embedded TLS files of the context to the papa home and sets their paths in the daemon.
+func saveCertificates(name string, d *Daemon, certs *portableCertificates) (err error) {
+	for _, f := range []struct {
+		content  string
+		path     *string
+		fileName string
+	}{{certs.CA, &d.TLSCACert, "ca.pem"}, {certs.Cert, &d.TLSCert, "cert.pem"}, {certs.Key, &d.TLSKey, "key.pem"}} {
+		if len(f.content) == 0 {
+			continue
+		}
+
+		var filePath string
+		if filePath, err = home.Load().Path(path.Join(certificateDir, name, f.fileName)); err != nil {
+			return
+		}
+
+		if err = utils.WriteFileAtomically(filePath, []byte(f.content), 0600); err != nil {
+			err = fmt.Errorf("fail to save TLS file %s cuz %s", f.fileName, err)
+			return
+		}
+
+		*f.path = filePath
+	}
+
+	return
+}
@@ -0,0 +1,72 @@
+package ctx
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/mitchellh/go-homedir"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "papa-ctx")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	os.Setenv("HOME", dir)
+	homedir.DisableCache = true
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestExportEmbedsCertificates(t *testing.T) {
+	const caCert = "-----BEGIN CERTIFICATE-----\nca\n-----END CERTIFICATE-----\n"
+	caPath := filepath.Join(os.Getenv("HOME"), "ca.pem")
+	if err := ioutil.WriteFile(caPath, []byte(caCert), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keyPath := filepath.Join(os.Getenv("HOME"), "key.pem")
+	if err := ioutil.WriteFile(keyPath, []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Create(&Context{Name: "prod", Registry: "registry.example.com",
+		Daemon: &Daemon{Host: "tcp://docker.example.com:2376", TLSCACert: caPath, TLSKey: keyPath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported := &bytes.Buffer{}
+	if err = Export("prod", exported, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(exported.String(), caPath) || strings.Contains(exported.String(), "key") {
+		t.Errorf("local paths or secrets are exported: %s", exported)
+	}
+
+	c, err := Import(exported, "prod-copy", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Daemon.TLSCACert == caPath || len(c.Daemon.TLSKey) > 0 {
+		t.Fatalf("unexpected TLS files %+v", c.Daemon)
+	}
+
+	content, err := ioutil.ReadFile(c.Daemon.TLSCACert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != caCert {
+		t.Errorf("expected CA certificate %q, but got %q", caCert, content)
+	}
+}
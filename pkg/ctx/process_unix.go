@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package ctx
+
+import (
+	"syscall"
+)
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
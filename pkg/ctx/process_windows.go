@@ -0,0 +1,16 @@
+package ctx
+
+import (
+	"os"
+)
+
+// processAlive relies on that FindProcess fails on Windows if the process doesn't exist.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	p.Release()
+	return true
+}
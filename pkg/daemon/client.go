@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"fmt"
+	"github.com/docker/docker/client"
+	"github.com/kitt1987/docker-papa/pkg/ctx"
+	"github.com/mitchellh/go-homedir"
+	"net/url"
+	"os"
+)
+
+const (
+	// DefaultAPIVersion is used if no API version is specified in the context.
+	DefaultAPIVersion = "1.29"
+)
+
+// NewClient returns a client connecting to the host. If the host is empty, the daemon of the current context is
+// used, or the one specified by environment variables like DOCKER_HOST if the context has no daemon.
+func NewClient(host string) (cli *client.Client, err error) {
+	if len(host) > 0 {
+		return newClient(&ctx.Daemon{Host: host})
+	}
+
+	daemon, err := CurrentDaemon()
+	if err != nil {
+		return
+	}
+
+	if daemon == nil || len(daemon.Host) == 0 {
+		version := DefaultAPIVersion
+		if daemon != nil && len(daemon.APIVersion) > 0 {
+			version = daemon.APIVersion
+		}
+
+		return client.NewClientWithOpts(client.FromEnv, client.WithVersion(version))
+	}
+
+	return newClient(daemon)
+}
+
+// CurrentDaemon returns the daemon of the current context. nil is returned if no context is used.
+func CurrentDaemon() (daemon *ctx.Daemon, err error) {
+	current, err := ctx.Current()
+	if os.IsNotExist(err) {
+		// No context is used yet.
+		return nil, nil
+	}
+
+	if err != nil {
+		err = fmt.Errorf("fail to load the current context cuz %s", err)
+		return
+	}
+
+	if current == nil || len(current.Name) == 0 {
+		return
+	}
+
+	// The current context keeps a copy of the context when switching. Changes made after switching are loaded too.
+	c, err := ctx.Load(current.Name)
+	if err != nil {
+		err = fmt.Errorf("fail to load the current context %s cuz %s", current.Name, err)
+		return
+	}
+
+	daemon = c.Daemon
+	return
+}
+
+func newClient(daemon *ctx.Daemon) (cli *client.Client, err error) {
+	version := daemon.APIVersion
+	if len(version) == 0 {
+		version = DefaultAPIVersion
+	}
+
+	opts := []func(*client.Client) error{client.WithVersion(version)}
+	hostURL, err := url.Parse(daemon.Host)
+	if err != nil {
+		err = fmt.Errorf("invalid daemon host %s cuz %s", daemon.Host, err)
+		return
+	}
+
+	if hostURL.Scheme == "ssh" {
+		var dialer *sshDialer
+		if dialer, err = newSSHDialer(hostURL); err != nil {
+			return
+		}
+
+		// Requests are forwarded to the daemon by the ssh connection, so the address is only a placeholder.
+		opts = append(opts, client.WithHost("http://docker"), client.WithDialContext(dialer.DialContext))
+	} else {
+		opts = append(opts, client.WithHost(daemon.Host))
+	}
+
+	if daemon.TLS() {
+		var caCert, cert, key string
+		for _, p := range []struct {
+			from string
+			to   *string
+		}{{daemon.TLSCACert, &caCert}, {daemon.TLSCert, &cert}, {daemon.TLSKey, &key}} {
+			if *p.to, err = homedir.Expand(p.from); err != nil {
+				return
+			}
+		}
+
+		opts = append(opts, client.WithTLSClientConfig(caCert, cert, key))
+	}
+
+	return client.NewClientWithOpts(opts...)
+}
@@ -0,0 +1,155 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// sshDialer connects to a remote daemon by running "docker system dial-stdio" through ssh, which requires docker
+// 18.09 or later on the remote host.
+type sshDialer struct {
+	args []string
+}
+
+func newSSHDialer(hostURL *url.URL) (d *sshDialer, err error) {
+	if len(hostURL.Hostname()) == 0 {
+		err = fmt.Errorf("no host found in %s", hostURL)
+		return
+	}
+
+	if len(hostURL.Path) > 0 && hostURL.Path != "/" {
+		err = fmt.Errorf("path is not supported in %s", hostURL)
+		return
+	}
+
+	d = &sshDialer{}
+	if hostURL.User != nil {
+		d.args = append(d.args, "-l", hostURL.User.Username())
+	}
+
+	if len(hostURL.Port()) > 0 {
+		d.args = append(d.args, "-p", hostURL.Port())
+	}
+
+	d.args = append(d.args, "--", hostURL.Hostname(), "docker", "system", "dial-stdio")
+	return
+}
+
+// DialContext starts ssh. The command lives as long as the connection rather than the dialing context, but it is
+// killed if the context is done before the connection is established, i.e. anything is received from the daemon.
+func (d *sshDialer) DialContext(ctx context.Context, _, _ string) (conn net.Conn, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	cmd := exec.Command("ssh", d.args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+
+	if err = cmd.Start(); err != nil {
+		err = fmt.Errorf("fail to run ssh cuz %s", err)
+		return
+	}
+
+	c := &commandConn{
+		cmd:         cmd,
+		stdin:       stdin,
+		stdout:      stdout,
+		established: make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-c.established:
+		case <-c.closed:
+		}
+	}()
+
+	conn = c
+	return
+}
+
+// commandConn is a connection over stdin and stdout of a command.
+type commandConn struct {
+	cmd         *exec.Cmd
+	stdin       io.WriteCloser
+	stdout      io.ReadCloser
+	established chan struct{}
+	closed      chan struct{}
+	readOnce    sync.Once
+	closeOnce   sync.Once
+}
+
+func (c *commandConn) Read(p []byte) (n int, err error) {
+	n, err = c.stdout.Read(p)
+	if n > 0 {
+		c.readOnce.Do(func() { close(c.established) })
+	}
+
+	return
+}
+
+func (c *commandConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *commandConn) Close() (err error) {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.stdin.Close()
+		c.stdout.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+
+	return
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return dummyAddr{}
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return dummyAddr{}
+}
+
+// Deadlines are not supported by pipes of commands.
+func (c *commandConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type dummyAddr struct{}
+
+func (dummyAddr) Network() string {
+	return "ssh"
+}
+
+func (dummyAddr) String() string {
+	return "ssh"
+}
@@ -1,8 +1,67 @@
 package history
 
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// BackendYAML keeps logs in a YAML file which is rewritten on each change.
+	BackendYAML = "yaml"
+	// BackendJSONLines appends logs to a file line by line in JSON.
+	BackendJSONLines = "jsonl"
+)
+
+var (
+	// Backend is the backend used by OpenFile.
+	Backend = BackendYAML
+	// MaxSize is the maximum number of logs kept in a file. The oldest logs are evicted first. 0 means unlimited.
+	MaxSize = 1000
+)
+
 type File interface {
-	Log(key string, content string)
+	// Log appends the entry. The time of the entry is set to now if it is zero.
+	Log(entry Entry)
 	Search(key string) []string
+	// Entries returns logs of the key in the order they were written. All logs are returned if the key is empty.
+	Entries(key string) []Entry
+	// Purge removes logs of the key written before the time. Logs of all keys are removed if the key is empty.
+	// The number of removed logs is returned.
+	Purge(key string, before time.Time) int
+	// Truncate keeps only the latest size logs.
 	Truncate(size int)
-	Close()
+	// Close writes logs back and releases the file.
+	Close() error
+}
+
+type Entry struct {
+	Time    time.Time `yaml:"time" json:"time"`
+	Key     string    `yaml:"key" json:"key"`
+	Content string    `yaml:"content" json:"content"`
+	// Host is where the entry is from, such as the docker daemon.
+	Host string `yaml:"host,omitempty" json:"host,omitempty"`
+	// User is who writes the entry.
+	User string `yaml:"user,omitempty" json:"user,omitempty"`
+	// Detail is a JSON document which keeps exact data the content is rendered from.
+	Detail string `yaml:"detail,omitempty" json:"detail,omitempty"`
+}
+
+// OpenFile opens and locks the history file in Backend until it is closed. A missing file is treated as an empty
+// one.
+func OpenFile(filePath string) (File, error) {
+	return OpenBackendFile(Backend, filePath)
+}
+
+// OpenBackendFile opens the history file in the backend. Files of different backends are stored separately.
+func OpenBackendFile(backend, filePath string) (f File, err error) {
+	switch backend {
+	case BackendYAML:
+		return openYamlFile(filePath)
+	case BackendJSONLines:
+		return openJSONLinesFile(filePath + jsonLinesSuffix)
+	default:
+		err = fmt.Errorf("unknown history backend %s, only %s and %s are supported", backend, BackendYAML,
+			BackendJSONLines)
+		return
+	}
 }
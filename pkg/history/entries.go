@@ -0,0 +1,33 @@
+package history
+
+import (
+	"strings"
+	"time"
+)
+
+// filterEntries returns logs of the key. All logs are returned if the key is empty.
+func filterEntries(logs []Entry, key string) (entries []Entry) {
+	lowerKey := strings.ToLower(key)
+	for _, log := range logs {
+		if len(key) == 0 || strings.ToLower(log.Key) == lowerKey {
+			entries = append(entries, log)
+		}
+	}
+
+	return
+}
+
+// purgeEntries removes logs of the key written before the time.
+func purgeEntries(logs []Entry, key string, before time.Time) (kept []Entry, purged int) {
+	lowerKey := strings.ToLower(key)
+	for _, log := range logs {
+		if (len(key) == 0 || strings.ToLower(log.Key) == lowerKey) && log.Time.Before(before) {
+			purged++
+			continue
+		}
+
+		kept = append(kept, log)
+	}
+
+	return
+}
@@ -0,0 +1,218 @@
+package history
+
+import (
+	"fmt"
+	"github.com/mitchellh/go-homedir"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+var backends = []string{BackendYAML, BackendJSONLines}
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "papa-history")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	os.Setenv("HOME", dir)
+	homedir.DisableCache = true
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// setMaxSize changes MaxSize and returns the function restoring it.
+func setMaxSize(size int) (restore func()) {
+	former := MaxSize
+	MaxSize = size
+	return func() { MaxSize = former }
+}
+
+func logN(t *testing.T, backend, filePath string, n int) {
+	f, err := OpenBackendFile(backend, filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < n; i++ {
+		f.Log(Entry{Key: "turtle", Content: fmt.Sprintf("docker run turtle:%d", i)})
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func entriesOf(t *testing.T, backend, filePath string) []Entry {
+	f, err := OpenBackendFile(backend, filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+	return f.Entries("")
+}
+
+func TestConcurrentLog(t *testing.T) {
+	const writers = 20
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			filePath := "test/concurrent-" + backend
+			var wg sync.WaitGroup
+			errs := make(chan error, writers)
+			for i := 0; i < writers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					f, err := OpenBackendFile(backend, filePath)
+					if err != nil {
+						errs <- err
+						return
+					}
+
+					f.Log(Entry{Key: fmt.Sprintf("container-%d", i), Content: "docker run turtle"})
+					errs <- f.Close()
+				}(i)
+			}
+
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if entries := entriesOf(t, backend, filePath); len(entries) != writers {
+				t.Errorf("expected %d logs, but got %d", writers, len(entries))
+			}
+		})
+	}
+}
+
+func TestEviction(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			defer setMaxSize(4)()
+			filePath := "test/eviction-" + backend
+			logN(t, backend, filePath, 6)
+			entries := entriesOf(t, backend, filePath)
+			if len(entries) != 4 {
+				t.Fatalf("expected 4 logs, but got %d", len(entries))
+			}
+
+			if entries[0].Content != "docker run turtle:2" || entries[3].Content != "docker run turtle:5" {
+				t.Errorf("the oldest logs should be evicted but got %v", entries)
+			}
+		})
+	}
+}
+
+func TestReadOnlyCloseKeepsLogs(t *testing.T) {
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			filePath := "test/read-only-" + backend
+			defer setMaxSize(0)()
+			logN(t, backend, filePath, 8)
+
+			MaxSize = 4
+			f, err := OpenBackendFile(backend, filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			f.Entries("turtle")
+			if err = f.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			MaxSize = 0
+			if entries := entriesOf(t, backend, filePath); len(entries) != 8 {
+				t.Errorf("expected 8 logs kept after reading, but got %d", len(entries))
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	defer setMaxSize(0)()
+	filePath := "test/migrate"
+	logN(t, BackendYAML, filePath, 6)
+
+	MaxSize = 4
+	if _, err := Migrate(filePath, BackendYAML, BackendJSONLines); err == nil {
+		t.Errorf("logs beyond the max size are migrated")
+	}
+
+	if entries := entriesOf(t, BackendJSONLines, filePath); len(entries) != 0 {
+		t.Errorf("expected nothing migrated, but got %d logs", len(entries))
+	}
+
+	MaxSize = 10
+	migrated, err := Migrate(filePath, BackendYAML, BackendJSONLines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if migrated != 6 {
+		t.Errorf("expected 6 logs migrated, but got %d", migrated)
+	}
+
+	if entries := entriesOf(t, BackendYAML, filePath); len(entries) != 6 {
+		t.Errorf("expected the source untouched, but got %d logs", len(entries))
+	}
+}
+
+func TestMigrateKeepsSameLogs(t *testing.T) {
+	filePath := "test/migrate-same"
+	f, err := OpenBackendFile(BackendJSONLines, filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		f.Log(Entry{Key: "turtle", Content: "docker run turtle"})
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = Migrate(filePath, BackendJSONLines, BackendYAML); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries := entriesOf(t, BackendYAML, filePath); len(entries) != 3 {
+		t.Errorf("expected 3 logs migrated to %s, but got %d", BackendYAML, len(entries))
+	}
+}
+
+func TestFilesArePrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on Windows")
+	}
+
+	for _, backend := range backends {
+		t.Run(backend, func(t *testing.T) {
+			filePath := "test/private-" + backend
+			logN(t, backend, filePath, 1)
+			if backend == BackendJSONLines {
+				filePath += jsonLinesSuffix
+			}
+
+			info, err := os.Stat(os.Getenv("HOME") + "/.papa/" + filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if mode := info.Mode().Perm(); mode != 0600 {
+				t.Errorf("expected mode 0600 of history, but got %o", mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/kitt1987/docker-papa/pkg/home"
+	"github.com/kitt1987/docker-papa/pkg/utils"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	jsonLinesSuffix = ".jsonl"
+	// maxJSONLineSize limits the size of a log since details of containers could be large.
+	maxJSONLineSize = 16 * 1024 * 1024
+)
+
+// jsonHeader is the first line of a JSON lines file.
+type jsonHeader struct {
+	Version int `json:"version"`
+}
+
+// jsonLine is a line of a JSON lines file, either the header or a log.
+type jsonLine struct {
+	Version int `json:"version,omitempty"`
+	Entry
+}
+
+// jsonLinesFile is a file of logs in JSON lines. New logs are appended to the file in one write, so a crash could
+// only leave a broken last line, which is skipped when read. The whole file is rewritten only if logs are
+// removed. It is locked from being opened until being closed.
+type jsonLinesFile struct {
+	path string
+	logs []Entry
+	// appended is the number of trailing logs not written yet.
+	appended int
+	// rewrite is set if logs are removed, so that the whole file must be rewritten.
+	rewrite bool
+	unlock  func() error
+}
+
+// Log appends the entry. Unlike the YAML backend, a log same as the last one is appended too.
+func (f *jsonLinesFile) Log(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	f.logs = append(f.logs, entry)
+	f.appended++
+}
+
+func (f *jsonLinesFile) Search(key string) (content []string) {
+	for _, log := range filterEntries(f.logs, key) {
+		content = append(content, log.Content)
+	}
+
+	return
+}
+
+func (f *jsonLinesFile) Entries(key string) []Entry {
+	return filterEntries(f.logs, key)
+}
+
+func (f *jsonLinesFile) Purge(key string, before time.Time) (purged int) {
+	f.logs, purged = purgeEntries(f.logs, key, before)
+	f.rewrite = f.rewrite || purged > 0
+	return
+}
+
+func (f *jsonLinesFile) Truncate(size int) {
+	if len(f.logs) > size {
+		f.logs = f.logs[len(f.logs)-size:]
+		f.rewrite = true
+	}
+}
+
+func (f *jsonLinesFile) replace(logs []Entry) {
+	f.logs = logs
+	f.appended = 0
+	f.rewrite = true
+}
+
+// Close writes new logs and releases the lock. Since eviction rewrites the whole file, the oldest logs are evicted
+// only if any log is written and a quarter more logs than MaxSize are kept, so that most closes only append.
+func (f *jsonLinesFile) Close() (err error) {
+	if f.unlock == nil {
+		return fmt.Errorf("history %s is already closed", f.path)
+	}
+
+	defer func() {
+		if unlockErr := f.unlock(); err == nil {
+			err = unlockErr
+		}
+
+		f.unlock = nil
+	}()
+
+	if MaxSize > 0 && f.appended > 0 && len(f.logs) > MaxSize+MaxSize/4 {
+		f.Truncate(MaxSize)
+	}
+
+	switch {
+	case f.rewrite:
+		err = f.writeAll()
+	case f.appended > 0:
+		err = f.appendNewLogs()
+	}
+
+	if err != nil {
+		err = fmt.Errorf("fail to write history %s cuz %s", f.path, err)
+		return
+	}
+
+	f.appended = 0
+	f.rewrite = false
+	return
+}
+
+func (f *jsonLinesFile) encode(buf *bytes.Buffer, logs []Entry) (err error) {
+	encoder := json.NewEncoder(buf)
+	for _, log := range logs {
+		if err = encoder.Encode(jsonLine{Entry: log}); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (f *jsonLinesFile) writeAll() (err error) {
+	buf := &bytes.Buffer{}
+	if err = json.NewEncoder(buf).Encode(jsonHeader{Version: schemaVersion}); err != nil {
+		return
+	}
+
+	if err = f.encode(buf, f.logs); err != nil {
+		return
+	}
+
+	return utils.WriteFileAtomically(f.path, buf.Bytes(), 0600)
+}
+
+func (f *jsonLinesFile) appendNewLogs() (err error) {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+
+	defer file.Close()
+	// Logs may contain secrets, such as environment variables of containers. Files written by old versions are
+	// readable by others.
+	if err = file.Chmod(0600); err != nil {
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	if info.Size() == 0 {
+		if err = json.NewEncoder(buf).Encode(jsonHeader{Version: schemaVersion}); err != nil {
+			return
+		}
+	} else {
+		// Terminate the broken line left by a crash.
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, info.Size()-1); err != nil {
+			return
+		}
+
+		if last[0] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+
+	if err = f.encode(buf, f.logs[len(f.logs)-f.appended:]); err != nil {
+		return
+	}
+
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		return
+	}
+
+	return file.Sync()
+}
+
+func (f *jsonLinesFile) read() (err error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	defer file.Close()
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for lineNo := 1; ; lineNo++ {
+		var line []byte
+		line, err = readLine(reader)
+		if err == io.EOF {
+			err = nil
+			break
+		}
+
+		if err != nil {
+			return
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var l jsonLine
+		if err := json.Unmarshal(line, &l); err != nil {
+			glog.Warningf("skip broken line %d of history %s: %s", lineNo, f.path, err)
+			continue
+		}
+
+		if l.Version > 0 {
+			if l.Version > schemaVersion {
+				return fmt.Errorf("version %d of history %s is not supported, upgrade docker-papa to read it",
+					l.Version, f.path)
+			}
+
+			continue
+		}
+
+		f.logs = append(f.logs, l.Entry)
+	}
+
+	return
+}
+
+// readLine reads a line no longer than maxJSONLineSize.
+func readLine(reader *bufio.Reader) (line []byte, err error) {
+	for {
+		var fragment []byte
+		var isPrefix bool
+		fragment, isPrefix, err = reader.ReadLine()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				err = nil
+			}
+
+			return
+		}
+
+		line = append(line, fragment...)
+		if len(line) > maxJSONLineSize {
+			err = fmt.Errorf("line longer than %d bytes", maxJSONLineSize)
+			return
+		}
+
+		if !isPrefix {
+			return
+		}
+	}
+}
+
+func openJSONLinesFile(filePath string) (f File, err error) {
+	papaHome := home.Load()
+	lf := &jsonLinesFile{}
+	if lf.path, err = papaHome.Path(filePath); err != nil {
+		return
+	}
+
+	if lf.unlock, err = papaHome.Lock(filePath); err != nil {
+		err = fmt.Errorf("fail to lock history %s cuz %s", filePath, err)
+		return
+	}
+
+	if err = lf.read(); err != nil {
+		lf.unlock()
+		return
+	}
+
+	f = lf
+	return
+}
@@ -0,0 +1,69 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Migrate copies logs in the file of a backend to the file of another one. Logs already in the destination are
+// skipped and all logs are sorted by time. The source file is left untouched. Migration fails rather than evicting
+// logs if more than MaxSize logs would be kept.
+func Migrate(filePath, from, to string) (migrated int, err error) {
+	if from == to {
+		err = fmt.Errorf("history is already in %s", to)
+		return
+	}
+
+	src, err := OpenBackendFile(from, filePath)
+	if err != nil {
+		return
+	}
+
+	// Files only read are never rewritten on close.
+	defer src.Close()
+
+	dst, err := OpenBackendFile(to, filePath)
+	if err != nil {
+		return
+	}
+
+	type logID struct {
+		time         time.Time
+		key, content string
+	}
+
+	logs := dst.Entries("")
+	existed := make(map[logID]bool, len(logs))
+	for _, log := range logs {
+		existed[logID{log.Time.UTC(), log.Key, log.Content}] = true
+	}
+
+	for _, log := range src.Entries("") {
+		if !existed[logID{log.Time.UTC(), log.Key, log.Content}] {
+			logs = append(logs, log)
+			migrated++
+		}
+	}
+
+	sort.SliceStable(logs, func(i, j int) bool {
+		return logs[i].Time.Before(logs[j].Time)
+	})
+
+	if MaxSize > 0 && len(logs) > MaxSize {
+		dst.Close()
+		err = fmt.Errorf("%d logs would be kept in %s, more than the max size %d. raise the max size to migrate",
+			len(logs), to, MaxSize)
+		return
+	}
+
+	// Logs are copied verbatim since Log of some backends merges a log into the last one if they are the same.
+	dst.(replacer).replace(logs)
+	err = dst.Close()
+	return
+}
+
+// replacer is implemented by all backends to replace all logs in a file without merging or evicting any log.
+type replacer interface {
+	replace(logs []Entry)
+}
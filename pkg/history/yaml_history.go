@@ -1,42 +1,49 @@
 package history
 
 import (
+	"fmt"
 	"github.com/kitt1987/docker-papa/pkg/home"
-	"reflect"
+	"os"
 	"strings"
 	"time"
 )
 
-type log struct {
-	Time    time.Time `yaml:"time"`
-	Key     string    `yaml:"key"`
-	Content string    `yaml:"content"`
-}
+// schemaVersion is the version of the history file. Files without a version are written by old versions in which
+// entries have only time, key and content.
+const schemaVersion = 2
 
 type logSeries struct {
-	Logs []log `yaml:"logs"`
+	Version int     `yaml:"version,omitempty"`
+	Logs    []Entry `yaml:"logs"`
 }
 
+// logFile is a YAML file of logs. It is locked from being opened until being closed, so that logs written by
+// concurrent processes are not lost.
 type logFile struct {
 	path   string
 	series logSeries
+	dirty  bool
+	// appended is set if any log is written, so that the oldest logs are evicted on close.
+	appended bool
+	unlock   func() error
 }
 
-func (f *logFile) Log(key string, content string) {
+func (f *logFile) Log(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	f.dirty = true
+	f.appended = true
 	if len(f.series.Logs) > 0 {
 		lastLog := f.series.Logs[len(f.series.Logs)-1]
-		if lastLog.Key == key && reflect.DeepEqual(lastLog.Content, content) {
-			f.series.Logs[len(f.series.Logs)-1].Time = time.Now()
+		if lastLog.Key == entry.Key && lastLog.Content == entry.Content && lastLog.Detail == entry.Detail {
+			f.series.Logs[len(f.series.Logs)-1].Time = entry.Time
 			return
 		}
 	}
 
-	f.series.Logs = append(f.series.Logs, log{
-		Time:    time.Now(),
-		Key:     key,
-		Content: content,
-	})
-
+	f.series.Logs = append(f.series.Logs, entry)
 	return
 }
 
@@ -51,22 +58,91 @@ func (f *logFile) Search(key string) (content []string) {
 	return
 }
 
+func (f *logFile) Entries(key string) []Entry {
+	return filterEntries(f.series.Logs, key)
+}
+
+func (f *logFile) Purge(key string, before time.Time) (purged int) {
+	f.series.Logs, purged = purgeEntries(f.series.Logs, key, before)
+	f.dirty = f.dirty || purged > 0
+	return
+}
+
+// Truncate keeps only the latest size logs.
 func (f *logFile) Truncate(size int) {
 	if len(f.series.Logs) > size {
-		f.series.Logs = f.series.Logs[size:]
+		f.series.Logs = f.series.Logs[len(f.series.Logs)-size:]
+		f.dirty = true
 	}
 
 	return
 }
 
-func (f *logFile) Close() {
-	home.Load().WriteYaml(f.path, f.series)
+func (f *logFile) replace(logs []Entry) {
+	f.series.Logs = logs
+	f.dirty = true
+}
+
+// Close evicts the oldest logs beyond MaxSize if any log is written, writes logs back if anything changed and
+// releases the lock. Files only read are never rewritten.
+func (f *logFile) Close() (err error) {
+	if f.unlock == nil {
+		return fmt.Errorf("history %s is already closed", f.path)
+	}
+
+	defer func() {
+		if unlockErr := f.unlock(); err == nil {
+			err = unlockErr
+		}
+
+		f.unlock = nil
+	}()
+
+	if MaxSize > 0 && f.appended {
+		f.Truncate(MaxSize)
+	}
+
+	if !f.dirty {
+		return
+	}
+
+	f.series.Version = schemaVersion
+	if err = home.Load().WriteYaml(f.path, f.series); err != nil {
+		err = fmt.Errorf("fail to write history %s cuz %s", f.path, err)
+		return
+	}
+
+	f.dirty = false
+	f.appended = false
+	return
 }
 
-func OpenFile(filePath string) (f File, err error) {
+func openYamlFile(filePath string) (f File, err error) {
 	lf := &logFile{
 		path: filePath,
 	}
 
-	return lf, home.Load().ReadYaml(filePath, lf.series)
+	papaHome := home.Load()
+	if lf.unlock, err = papaHome.Lock(filePath); err != nil {
+		err = fmt.Errorf("fail to lock history %s cuz %s", filePath, err)
+		return
+	}
+
+	err = papaHome.ReadYaml(filePath, &lf.series)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+
+	if err == nil && lf.series.Version > schemaVersion {
+		err = fmt.Errorf("version %d of history %s is not supported, upgrade docker-papa to read it",
+			lf.series.Version, filePath)
+	}
+
+	if err != nil {
+		lf.unlock()
+		return
+	}
+
+	f = lf
+	return
 }
@@ -1,8 +1,17 @@
 package home
 
 type PaPaHome interface {
+	// WriteYaml writes the file which only the user can read and write.
 	WriteYaml(path string, yaml interface{}) error
 	ReadYaml(path string, yaml interface{}) error
+	// ReadDir returns names of files in the directory, except hidden ones.
+	ReadDir(dir string) ([]string, error)
+	// Remove removes the file. It is not an error if the file doesn't exist.
+	Remove(path string) error
+	// Path returns the absolute path of a file in home. Its parent directory is created if not exist.
+	Path(path string) (string, error)
+	// Lock locks the file exclusively among processes. The returned function releases the lock.
+	Lock(path string) (unlock func() error, err error)
 }
 
 func Load() PaPaHome {
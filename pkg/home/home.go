@@ -5,7 +5,10 @@ import (
 	"github.com/docker/docker/pkg/fileutils"
 	"github.com/kitt1987/docker-papa/pkg/utils"
 	"github.com/mitchellh/go-homedir"
+	"io/ioutil"
+	"os"
 	"path"
+	"strings"
 )
 
 type papaHome struct {
@@ -23,7 +26,8 @@ func (h *papaHome) WriteYaml(file string, obj interface{}) (err error) {
 		return
 	}
 
-	return utils.WriteYaml(path.Join(filePath, fileName), obj)
+	// Files in home may contain secrets like passwords of registries.
+	return utils.WritePrivateYaml(path.Join(filePath, fileName), obj)
 }
 
 func (h *papaHome) ReadYaml(file string, obj interface{}) (err error) {
@@ -41,6 +45,60 @@ func (h *papaHome) ReadYaml(file string, obj interface{}) (err error) {
 	return utils.ReadYaml(path.Join(filePath, fileName), obj)
 }
 
+func (h *papaHome) Path(file string) (filePath string, err error) {
+	fileName := path.Base(file)
+	if fileName == "." || fileName == "/" {
+		err = fmt.Errorf("not a file path: %s", file)
+		return
+	}
+
+	if filePath, err = h.AssureParentDir(file); err != nil {
+		return
+	}
+
+	filePath = path.Join(filePath, fileName)
+	return
+}
+
+func (h *papaHome) ReadDir(dir string) (names []string, err error) {
+	homePath, err := getHomePath()
+	if err != nil {
+		return
+	}
+
+	files, err := ioutil.ReadDir(path.Join(homePath, dir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
+		names = append(names, f.Name())
+	}
+
+	return
+}
+
+func (h *papaHome) Remove(file string) (err error) {
+	filePath, err := h.Path(file)
+	if err != nil {
+		return
+	}
+
+	if err = os.Remove(filePath); os.IsNotExist(err) {
+		err = nil
+	}
+
+	return
+}
+
 func (h *papaHome) AssureParentDir(file string) (filePath string, err error) {
 	homePath, err := getHomePath()
 	if err != nil {
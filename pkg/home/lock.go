@@ -0,0 +1,60 @@
+package home
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	lockSuffix       = ".lock"
+	lockTimeout      = 30 * time.Second
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// Lock locks a file beside the file with the suffix .lock, so that the file itself could be replaced by renaming.
+// It gives up if the lock is held by others longer than lockTimeout.
+func (h *papaHome) Lock(file string) (unlock func() error, err error) {
+	filePath, err := h.AssureParentDir(file)
+	if err != nil {
+		return
+	}
+
+	lockPath := path.Join(filePath, path.Base(file)+lockSuffix)
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		var locked bool
+		if locked, err = tryLock(f); err != nil || locked {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			err = fmt.Errorf("%s is locked by another process", lockPath)
+			break
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	unlock = func() error {
+		if err := releaseLock(f); err != nil {
+			f.Close()
+			return err
+		}
+
+		return f.Close()
+	}
+
+	return
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package home
+
+import (
+	"os"
+	"syscall"
+)
+
+func tryLock(f *os.File) (locked bool, err error) {
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func releaseLock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
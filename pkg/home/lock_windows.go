@@ -0,0 +1,45 @@
+package home
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// tryLock locks the first byte of the file exclusively by LockFileEx without waiting.
+func tryLock(f *os.File) (locked bool, err error) {
+	overlapped := &syscall.Overlapped{}
+	r, _, errno := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0,
+		uintptr(unsafe.Pointer(overlapped)))
+	if r != 0 {
+		return true, nil
+	}
+
+	if errno == errorLockViolation {
+		return false, nil
+	}
+
+	return false, errno
+}
+
+func releaseLock(f *os.File) error {
+	overlapped := &syscall.Overlapped{}
+	r, _, errno := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(overlapped)))
+	if r == 0 {
+		return errno
+	}
+
+	return nil
+}
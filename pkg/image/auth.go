@@ -0,0 +1,120 @@
+package image
+
+import (
+	"fmt"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/auth/challenge"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/golang/glog"
+	"github.com/kitt1987/docker-papa/pkg/ctx"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// credentialStore provides credentials of a registry to the token and basic auth handlers.
+type credentialStore struct {
+	auth          registryAuth
+	lock          sync.Mutex
+	refreshTokens map[string]string
+}
+
+// Basic returns the username and password only for HTTPS URLs, so that they are never sent in cleartext.
+func (s *credentialStore) Basic(u *url.URL) (string, string) {
+	if !secure(u) {
+		glog.V(3).Infof("credentials are not sent to %s over plain HTTP", u.Host)
+		return "", ""
+	}
+
+	return s.auth.Username, s.auth.Password
+}
+
+func (s *credentialStore) RefreshToken(u *url.URL, service string) string {
+	if !secure(u) {
+		return ""
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if token, found := s.refreshTokens[service]; found {
+		return token
+	}
+
+	return s.auth.IdentityToken
+}
+
+func (s *credentialStore) SetRefreshToken(_ *url.URL, service, token string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.refreshTokens[service] = token
+}
+
+func secure(u *url.URL) bool {
+	return u != nil && u.Scheme == "https"
+}
+
+// newCredentialStore returns credentials of the registry host. Credentials in the context take precedence over
+// the docker config. Nil is returned if no credentials found.
+func newCredentialStore(host string, credentials *ctx.Credentials) (s *credentialStore, err error) {
+	var ra *registryAuth
+	if credentials != nil && len(credentials.Username) > 0 {
+		ra = &registryAuth{Username: credentials.Username, Password: credentials.Password}
+	} else if ra, err = dockerConfigAuth(host); err != nil || ra == nil {
+		return
+	}
+
+	s = &credentialStore{
+		auth:          *ra,
+		refreshTokens: make(map[string]string),
+	}
+
+	return
+}
+
+// newRegistryTransport pings the registry at baseURL and returns a transport which answers its auth challenges,
+// the docker token flow or basic auth, for pushing to and pulling from the repository.
+func newRegistryTransport(baseURL, repo string, credentials *ctx.Credentials) (rt http.RoundTripper, err error) {
+	base := http.DefaultTransport
+	pingURL := strings.TrimSuffix(baseURL, "/") + "/v2/"
+	resp, err := (&http.Client{Transport: base}).Get(pingURL)
+	if err != nil {
+		return
+	}
+
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		err = fmt.Errorf("registry %s responses %s", pingURL, resp.Status)
+		return
+	}
+
+	manager := challenge.NewSimpleManager()
+	if err = manager.AddResponse(resp); err != nil {
+		return
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		return base, nil
+	}
+
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return
+	}
+
+	creds, err := newCredentialStore(u.Host, credentials)
+	if err != nil {
+		return
+	}
+
+	if creds == nil {
+		glog.V(3).Infof("no credentials found for %s. try anonymous access", u.Host)
+		creds = &credentialStore{refreshTokens: make(map[string]string)}
+	}
+
+	rt = transport.NewTransport(base, auth.NewAuthorizer(manager,
+		auth.NewTokenHandler(base, creds, repo, "pull", "push"),
+		auth.NewBasicHandler(creds),
+	))
+	return
+}
@@ -0,0 +1,149 @@
+package image
+
+import (
+	"compress/gzip"
+	"fmt"
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/opencontainers/go-digest"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Compression is the algorithm layers are compressed with before being pushed.
+type Compression string
+
+const (
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd requires the zstd command and OCI-compatible registries and runtimes.
+	CompressionZstd Compression = "zstd"
+	CompressionNone Compression = "none"
+
+	// DefaultCompressionLevel lets the compressor choose the level.
+	DefaultCompressionLevel = 0
+
+	mediaTypeZstdLayer = "application/vnd.oci.image.layer.v1.tar+zstd"
+)
+
+// Validate checks whether the compression and its level are supported.
+func (c Compression) Validate(level int) error {
+	switch c {
+	case CompressionGzip:
+		if level != DefaultCompressionLevel && (level < gzip.BestSpeed || level > gzip.BestCompression) {
+			return fmt.Errorf("gzip level should be between %d and %d, or 0 for the default level",
+				gzip.BestSpeed, gzip.BestCompression)
+		}
+	case CompressionZstd:
+		if level < DefaultCompressionLevel || level > 19 {
+			return fmt.Errorf("zstd level should be between 1 and 19, or 0 for the default level")
+		}
+
+		if _, err := exec.LookPath("zstd"); err != nil {
+			return fmt.Errorf("zstd compression requires the zstd command cuz %s", err)
+		}
+	case CompressionNone:
+	default:
+		return fmt.Errorf("unknown compression %s. only gzip, zstd and none are supported", c)
+	}
+
+	return nil
+}
+
+// Compress compresses the layer into a file besides it. The descriptor of the layer is then replaced by the
+// compressed blob, while the digest of the uncompressed tar is still its DiffID.
+func (l *layerLoader) Compress(compression Compression, level int) (err error) {
+	if compression == CompressionNone || len(l.compressedPath) > 0 {
+		return
+	}
+
+	src, err := os.Open(l.layerPath)
+	if err != nil {
+		return
+	}
+
+	defer src.Close()
+
+	compressedPath := l.layerPath + "." + string(compression)
+	dst, err := os.Create(compressedPath)
+	if err != nil {
+		return
+	}
+
+	defer dst.Close()
+
+	digester := digest.Canonical.Digester()
+	counter := &countingWriter{}
+	w := io.MultiWriter(dst, digester.Hash(), counter)
+	mediaType := schema2.MediaTypeLayer
+	switch compression {
+	case CompressionGzip:
+		err = gzipCompress(w, src, level)
+	case CompressionZstd:
+		mediaType = mediaTypeZstdLayer
+		err = zstdCompress(w, src, level)
+	default:
+		err = compression.Validate(level)
+	}
+
+	if err != nil {
+		err = fmt.Errorf("fail to compress layer %s cuz %s", l.descriptor.Digest, err)
+		return
+	}
+
+	if err = dst.Close(); err != nil {
+		return
+	}
+
+	l.compressedPath = compressedPath
+	l.descriptor = distribution.Descriptor{
+		MediaType: mediaType,
+		Size:      counter.n,
+		Digest:    digester.Digest(),
+		Platform:  l.descriptor.Platform,
+	}
+
+	return
+}
+
+func gzipCompress(w io.Writer, r io.Reader, level int) (err error) {
+	if level == DefaultCompressionLevel {
+		level = gzip.DefaultCompression
+	}
+
+	// The header is left empty so that the same layer is always compressed to the same blob.
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return
+	}
+
+	if _, err = io.Copy(gw, r); err != nil {
+		gw.Close()
+		return
+	}
+
+	return gw.Close()
+}
+
+func zstdCompress(w io.Writer, r io.Reader, level int) (err error) {
+	args := []string{"-q", "-c"}
+	if level != DefaultCompressionLevel {
+		args = append(args, "-"+strconv.Itoa(level))
+	}
+
+	cmd := exec.Command("zstd", args...)
+	cmd.Stdin = r
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
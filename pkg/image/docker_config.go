@@ -0,0 +1,168 @@
+package image
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/glog"
+	"github.com/mitchellh/go-homedir"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	dockerConfigEnv  = "DOCKER_CONFIG"
+	dockerConfigFile = "config.json"
+	// tokenUsername is the username returned by credential helpers if the secret is an identity token.
+	tokenUsername = "<token>"
+)
+
+// dockerConfig is the part of ~/.docker/config.json about registry credentials.
+type dockerConfig struct {
+	Auths       map[string]dockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore"`
+	CredHelpers map[string]string     `json:"credHelpers"`
+}
+
+type dockerAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// registryAuth is what is used to log in to a registry.
+type registryAuth struct {
+	Username      string
+	Password      string
+	IdentityToken string
+}
+
+func loadDockerConfig() (conf *dockerConfig, err error) {
+	dir := os.Getenv(dockerConfigEnv)
+	if len(dir) == 0 {
+		if dir, err = homedir.Expand("~/.docker"); err != nil {
+			return
+		}
+	}
+
+	f, err := os.Open(filepath.Join(dir, dockerConfigFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+
+		return
+	}
+
+	defer f.Close()
+	conf = &dockerConfig{}
+	if err = json.NewDecoder(f).Decode(conf); err != nil {
+		err = fmt.Errorf("fail to parse docker config %s cuz %s", f.Name(), err)
+	}
+
+	return
+}
+
+// dockerConfigAuth returns credentials of the registry host in the docker config, asking credential helpers if
+// configured. Nil is returned if not found.
+func dockerConfigAuth(host string) (ra *registryAuth, err error) {
+	conf, err := loadDockerConfig()
+	if err != nil || conf == nil {
+		return
+	}
+
+	helper := conf.CredHelpers[host]
+	if len(helper) == 0 {
+		helper = conf.CredsStore
+	}
+
+	if len(helper) > 0 {
+		if ra, err = credentialHelperAuth(helper, host); err == nil {
+			return
+		}
+
+		glog.V(3).Infof("credential helper %s failed: %s", helper, err)
+		err = nil
+	}
+
+	for server, a := range conf.Auths {
+		if registryHost(server) != host {
+			continue
+		}
+
+		ra = &registryAuth{
+			Username:      a.Username,
+			Password:      a.Password,
+			IdentityToken: a.IdentityToken,
+		}
+
+		if len(a.Auth) > 0 {
+			var decoded []byte
+			if decoded, err = base64.StdEncoding.DecodeString(a.Auth); err != nil {
+				err = fmt.Errorf("invalid auth of %s in docker config cuz %s", server, err)
+				return
+			}
+
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				err = fmt.Errorf("invalid auth of %s in docker config", server)
+				return
+			}
+
+			ra.Username, ra.Password = parts[0], parts[1]
+		}
+
+		return
+	}
+
+	return
+}
+
+// credentialHelperAuth runs docker-credential-<helper> get to fetch credentials of the host.
+func credentialHelperAuth(helper, host string) (ra *registryAuth, err error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(host)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		err = fmt.Errorf("%s cuz %s", strings.TrimSpace(stdout.String()+stderr.String()), err)
+		return
+	}
+
+	var resp struct {
+		Username string
+		Secret   string
+	}
+
+	if err = json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return
+	}
+
+	ra = &registryAuth{}
+	if resp.Username == tokenUsername {
+		ra.IdentityToken = resp.Secret
+	} else {
+		ra.Username, ra.Password = resp.Username, resp.Secret
+	}
+
+	return
+}
+
+// registryHost strips the scheme and path of a registry address like https://index.docker.io/v1/.
+func registryHost(server string) string {
+	host := server
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+
+	return host
+}
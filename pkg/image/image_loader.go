@@ -130,15 +130,31 @@ type manifestConf struct {
 	manifest *manifestItem
 	conf     *image.Image
 	rawConf  []byte
+	// layers are in the same order as DiffIDs in the configuration.
+	layers []*layerLoader
 }
 
+// GetLayers returns layers of all manifests in the image. A layer shared by manifests is returned only once.
 func (l *imageLoader) GetLayers() (layers []*layerLoader, err error) {
-	for _, m := range l.manifests {
+	loaded := make(map[string]*layerLoader)
+	for i := range l.manifests {
+		m := &l.manifests[i]
+		if len(m.manifest.Layers) != len(m.conf.RootFS.DiffIDs) {
+			err = fmt.Errorf("%d layers found in the manifest but %d in the configuration %s",
+				len(m.manifest.Layers), len(m.conf.RootFS.DiffIDs), m.manifest.Config)
+			return
+		}
+
+		m.layers = nil
 		for i := range m.manifest.Layers {
-			layerPath := m.manifest.Layers[i]
+			layerPath := filepath.Join(l.imageDir, m.manifest.Layers[i])
+			if layer, found := loaded[layerPath]; found {
+				m.layers = append(m.layers, layer)
+				continue
+			}
+
 			layerID := m.conf.RootFS.DiffIDs[i]
-			layerDir := filepath.Join(l.imageDir, filepath.Dir(layerPath))
-			layerPath = filepath.Join(l.imageDir, layerPath)
+			layerDir := filepath.Join(l.imageDir, filepath.Dir(m.manifest.Layers[i]))
 			var fi os.FileInfo
 			fi, err = os.Lstat(layerPath)
 			if err != nil {
@@ -146,9 +162,10 @@ func (l *imageLoader) GetLayers() (layers []*layerLoader, err error) {
 				return
 			}
 
-			layers = append(layers, &layerLoader{
+			layer := &layerLoader{
 				layerDir:  layerDir,
 				layerPath: layerPath,
+				diffID:    digest.Digest(layerID),
 				descriptor: distribution.Descriptor{
 					MediaType: schema2.MediaTypeUncompressedLayer,
 					Size:      fi.Size(),
@@ -158,23 +175,63 @@ func (l *imageLoader) GetLayers() (layers []*layerLoader, err error) {
 						OS:           m.conf.OS,
 					},
 				},
-			})
+			}
+
+			loaded[layerPath] = layer
+			m.layers = append(m.layers, layer)
+			layers = append(layers, layer)
 		}
 	}
 
 	return
 }
 
+// GetManifests returns manifests in the image. Layers of manifests are only available after GetLayers is called.
 func (l *imageLoader) GetManifests() (manifests []*manifestConf, err error) {
+	for i := range l.manifests {
+		manifests = append(manifests, &l.manifests[i])
+	}
+
 	return
 }
 
 type layerLoader struct {
-	layerDir   string
-	layerPath  string
+	layerDir  string
+	layerPath string
+	// compressedPath is the compressed layer if the layer is compressed.
+	compressedPath string
+	// diffID is the digest of the uncompressed layer.
+	diffID     digest.Digest
 	descriptor distribution.Descriptor
 }
 
+// ID returns the short ID of the layer shown in the progress like docker push.
+func (l *layerLoader) ID() string {
+	if id := l.diffID.Hex(); len(id) > 12 {
+		return id[:12]
+	}
+
+	return l.diffID.Hex()
+}
+
+// Descriptor returns the descriptor of the blob referenced by manifests.
+func (l *layerLoader) Descriptor() distribution.Descriptor {
+	return distribution.Descriptor{
+		MediaType: l.descriptor.MediaType,
+		Size:      l.descriptor.Size,
+		Digest:    l.descriptor.Digest,
+	}
+}
+
+// OpenReader opens the blob to be pushed, which is compressed if the layer is compressed.
 func (l *layerLoader) OpenReader() (r io.ReadCloser, err error) {
-	return os.Open(l.layerPath)
+	return os.Open(l.blobPath())
+}
+
+func (l *layerLoader) blobPath() string {
+	if len(l.compressedPath) > 0 {
+		return l.compressedPath
+	}
+
+	return l.layerPath
 }
@@ -0,0 +1,280 @@
+package image
+
+import (
+	"fmt"
+	"github.com/docker/go-units"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProgressMode is how the progress of direct pushes is displayed.
+type ProgressMode string
+
+const (
+	// ProgressAuto draws progress bars on terminals, or plain lines otherwise.
+	ProgressAuto ProgressMode = "auto"
+	// ProgressTTY redraws progress bars of all layers in place like docker push.
+	ProgressTTY ProgressMode = "tty"
+	// ProgressPlain prints a line once the status of a layer changes, which is friendly to CI logs.
+	ProgressPlain ProgressMode = "plain"
+
+	progressBarWidth = 50
+	redrawInterval   = 200 * time.Millisecond
+)
+
+// Validate checks whether the mode is supported.
+func (m ProgressMode) Validate() error {
+	switch m {
+	case ProgressAuto, ProgressTTY, ProgressPlain:
+		return nil
+	default:
+		return fmt.Errorf("unknown progress mode %s. only auto, tty and plain are supported", m)
+	}
+}
+
+type layerProgress struct {
+	id      string
+	status  string
+	current int64
+	total   int64
+	// startOffset and start are the offset and the time the current upload started, to calculate the rate.
+	startOffset int64
+	start       time.Time
+	finished    time.Time
+}
+
+func (l *layerProgress) rate(now time.Time) float64 {
+	elapsed := now.Sub(l.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+
+	return float64(l.current-l.startOffset) / elapsed
+}
+
+func (l *layerProgress) String() string {
+	line := l.id + ": " + l.status
+	if l.start.IsZero() || !l.finished.IsZero() || l.total <= 0 {
+		return line
+	}
+
+	filled := int(float64(progressBarWidth) * float64(l.current) / float64(l.total))
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+
+	bar := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+
+	now := time.Now()
+	line += fmt.Sprintf(" [%s] %s/%s", bar, units.HumanSize(float64(l.current)), units.HumanSize(float64(l.total)))
+	if rate := l.rate(now); rate > 0 {
+		eta := time.Duration(float64(l.total-l.current) / rate * float64(time.Second))
+		line += fmt.Sprintf(" %s/s %s", units.HumanSize(rate), eta.Round(time.Second))
+	}
+
+	return line
+}
+
+// pushProgress displays the status of each layer in a push.
+type pushProgress struct {
+	out         io.Writer
+	tty         bool
+	quiet       bool
+	lock        sync.Mutex
+	layers      []*layerProgress
+	byID        map[string]*layerProgress
+	transferred int64
+	started     time.Time
+	// drawn is the number of lines drawn in the last redraw.
+	drawn int
+	dirty bool
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newPushProgress(out io.Writer, tty, quiet bool) *pushProgress {
+	p := &pushProgress{
+		out:     out,
+		tty:     tty && !quiet,
+		quiet:   quiet,
+		byID:    make(map[string]*layerProgress),
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if !p.tty {
+		close(p.done)
+		return p
+	}
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(redrawInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.lock.Lock()
+				p.redraw()
+				p.lock.Unlock()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+
+	return p
+}
+
+// Add shows a layer as Preparing.
+func (p *pushProgress) Add(id string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, found := p.byID[id]; found {
+		return
+	}
+
+	l := &layerProgress{id: id}
+	p.layers = append(p.layers, l)
+	p.byID[id] = l
+	p.setStatus(l, "Preparing")
+}
+
+// SetStatus changes the status of the layer, like Waiting, Pushed or Layer already exists.
+func (p *pushProgress) SetStatus(id, status string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if l, found := p.byID[id]; found {
+		p.setStatus(l, status)
+	}
+}
+
+func (p *pushProgress) setStatus(l *layerProgress, status string) {
+	if l.status == status {
+		return
+	}
+
+	l.status = status
+	p.dirty = true
+	if p.quiet || p.tty {
+		return
+	}
+
+	line := l.id + ": " + status
+	if !l.finished.IsZero() && !l.start.IsZero() {
+		elapsed := l.finished.Sub(l.start)
+		line += fmt.Sprintf(" %s in %s", units.HumanSize(float64(l.total)), elapsed.Round(time.Millisecond))
+		if rate := l.rate(l.finished); rate > 0 {
+			line += fmt.Sprintf(" (%s/s)", units.HumanSize(rate))
+		}
+	}
+
+	fmt.Fprintln(p.out, line)
+}
+
+// Start shows a layer as Pushing from the offset, which is not 0 if the upload is resumed.
+func (p *pushProgress) Start(id string, offset, total int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if l, found := p.byID[id]; found {
+		l.current, l.startOffset, l.total = offset, offset, total
+		l.start = time.Now()
+		p.setStatus(l, "Pushing")
+	}
+}
+
+// Advance adds bytes sent of the layer.
+func (p *pushProgress) Advance(id string, n int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.transferred += n
+	if l, found := p.byID[id]; found {
+		l.current += n
+		p.dirty = true
+	}
+}
+
+// Finish shows a layer as Pushed.
+func (p *pushProgress) Finish(id string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if l, found := p.byID[id]; found {
+		l.current = l.total
+		l.finished = time.Now()
+		p.setStatus(l, "Pushed")
+	}
+}
+
+// Stop draws the final status of all layers. Messages can only be printed after stopped.
+func (p *pushProgress) Stop() {
+	select {
+	case <-p.stop:
+		return
+	default:
+		close(p.stop)
+	}
+
+	<-p.done
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.dirty = true
+	p.redraw()
+}
+
+// Summary prints the digest of the pushed manifest and bytes transferred.
+func (p *pushProgress) Summary(tag, dgst string, size int) {
+	p.Stop()
+	if p.quiet {
+		return
+	}
+
+	pushed, existed := 0, 0
+	for _, l := range p.layers {
+		if l.status == "Pushed" {
+			pushed++
+		} else {
+			existed++
+		}
+	}
+
+	fmt.Fprintf(p.out, "%s: digest: %s size: %d\n", tag, dgst, size)
+	fmt.Fprintf(p.out, "%d layers pushed, %d already existed, %s transferred in %s\n", pushed, existed,
+		units.HumanSize(float64(p.transferred)), time.Since(p.started).Round(time.Second))
+}
+
+// redraw moves the cursor back to the first layer and draws all layers again.
+func (p *pushProgress) redraw() {
+	if !p.tty || !p.dirty {
+		return
+	}
+
+	if p.drawn > 0 {
+		fmt.Fprintf(p.out, "\033[%dA", p.drawn)
+	}
+
+	for _, l := range p.layers {
+		fmt.Fprintf(p.out, "\033[2K\r%s\n", l)
+	}
+
+	p.drawn = len(p.layers)
+	p.dirty = false
+}
+
+// progressReader reports bytes read to the progress of the layer.
+type progressReader struct {
+	io.Reader
+	id       string
+	progress *pushProgress
+}
+
+func (r *progressReader) Read(b []byte) (n int, err error) {
+	n, err = r.Reader.Read(b)
+	r.progress.Advance(r.id, int64(n))
+	return
+}
@@ -4,14 +4,14 @@ import (
 	"context"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
-	dockerclient "github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/term"
+	"github.com/kitt1987/docker-papa/pkg/daemon"
 	"os"
 )
 
-func DockerPull(image string) (err error) {
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithVersion("1.29"))
+func DockerPull(image, host string) (err error) {
+	cli, err := daemon.NewClient(host)
 	if err != nil {
 		return
 	}
@@ -29,8 +29,8 @@ func DockerPull(image string) (err error) {
 	return
 }
 
-func ExistsLocally(image string) (yes bool, err error) {
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithVersion("1.29"))
+func ExistsLocally(image, host string) (yes bool, err error) {
+	cli, err := daemon.NewClient(host)
 	if err != nil {
 		return
 	}
@@ -4,24 +4,29 @@ import (
 	"context"
 	"fmt"
 	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/reference"
 	registryclient "github.com/docker/distribution/registry/client"
 	"github.com/docker/docker/api/types"
-	dockerclient "github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/term"
 	"github.com/golang/glog"
-	"github.com/opencontainers/go-digest"
+	"github.com/kitt1987/docker-papa/pkg/ctx"
+	"github.com/kitt1987/docker-papa/pkg/daemon"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 )
 
-func Push(image string) (err error) {
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithVersion("1.29"))
+// Push pushes the image through the daemon. The progress is discarded if quiet.
+func Push(image, host string, quiet bool) (err error) {
+	cli, err := daemon.NewClient(host)
 	if err != nil {
 		return
 	}
@@ -32,15 +37,77 @@ func Push(image string) (err error) {
 	}
 
 	defer resp.Close()
-	fd, isTerminal := term.GetFdInfo(os.Stdout)
-	if err := jsonmessage.DisplayJSONMessagesStream(resp, os.Stdout, fd, isTerminal, nil); err != nil {
+	var out io.Writer = os.Stdout
+	if quiet {
+		out = ioutil.Discard
+	}
+
+	fd, isTerminal := term.GetFdInfo(out)
+	if err := jsonmessage.DisplayJSONMessagesStream(resp, out, fd, isTerminal, nil); err != nil {
 		return err
 	}
 	return
 }
 
-func PushDirectly(image, remote string) (err error) {
-	cli, err := dockerclient.NewClientWithOpts(dockerclient.FromEnv, dockerclient.WithVersion("1.29"))
+// PushOptions are options of pushing images directly to registries.
+type PushOptions struct {
+	// Credentials are used to log in to the registry. Credentials in the docker config are used if nil.
+	Credentials *ctx.Credentials
+	// Insecure allows connecting to the registry over plain HTTP if HTTPS fails.
+	Insecure bool
+	// Compression is the algorithm layers are compressed with. Layers are gzipped if empty.
+	Compression      Compression
+	CompressionLevel int
+	// Parallelism is the number of layers uploaded concurrently.
+	Parallelism int
+	// ChunkSize is the size of each PATCH request. A failed upload is resumed from the last chunk the registry
+	// received.
+	ChunkSize int64
+	// Retries is the number of retries of each blob. DefaultRetries is used if negative.
+	Retries int
+	// BlobTimeout limits the time of uploading each blob, including retries.
+	BlobTimeout time.Duration
+	// Progress is how the progress is displayed. ProgressAuto is used if empty.
+	Progress ProgressMode
+	// Quiet suppresses the progress and the summary.
+	Quiet bool
+}
+
+// PushDirectly pushes the image to the remote registry without the daemon.
+func PushDirectly(image, remote, host string, opts *PushOptions) (err error) {
+	if len(opts.Compression) == 0 {
+		opts.Compression = CompressionGzip
+	}
+
+	if err = opts.Compression.Validate(opts.CompressionLevel); err != nil {
+		return
+	}
+
+	if len(opts.Progress) == 0 {
+		opts.Progress = ProgressAuto
+	}
+
+	if err = opts.Progress.Validate(); err != nil {
+		return
+	}
+
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = DefaultParallelism
+	}
+
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+
+	if opts.Retries < 0 {
+		opts.Retries = DefaultRetries
+	}
+
+	if opts.BlobTimeout <= 0 {
+		opts.BlobTimeout = DefaultBlobTimeout
+	}
+
+	cli, err := daemon.NewClient(host)
 	if err != nil {
 		return
 	}
@@ -53,12 +120,34 @@ func PushDirectly(image, remote string) (err error) {
 
 	defer imageLoader.Close()
 
+	// Only single-platform images are supported, which is checked before anything is uploaded.
+	manifests, err := imageLoader.GetManifests()
+	if err != nil {
+		glog.V(3).Infof("read local manifest failed: %s", err)
+		return
+	}
+
+	if len(manifests) != 1 {
+		err = fmt.Errorf("%d manifests found in image %s. only 1 is expected", len(manifests), image)
+		return
+	}
+
+	return pushImage(imageLoader, image, remote, opts)
+}
+
+// pushImage pushes layers, the configuration and the manifest of the loaded image to the remote registry.
+func pushImage(imageLoader *imageLoader, image, remote string, opts *PushOptions) (err error) {
 	repoName, err := reference.ParseNamed(image)
 	if err != nil {
 		glog.V(3).Infof("parse image %s failed: %s", image, err)
 		return
 	}
 
+	tag := "latest"
+	if tagged, ok := repoName.(reference.Tagged); ok {
+		tag = tagged.Tag()
+	}
+
 	repo := reference.Path(repoName)
 	repoName, err = reference.WithName(repo)
 	if err != nil {
@@ -71,18 +160,32 @@ func PushDirectly(image, remote string) (err error) {
 	if strings.HasPrefix(remote, "http") {
 		baseURLs = append(baseURLs, remote)
 	} else {
-		baseURLs = append(baseURLs, "http://"+remote, "https://"+remote)
+		baseURLs = append(baseURLs, "https://"+remote)
+		if opts.Insecure {
+			baseURLs = append(baseURLs, "http://"+remote)
+		}
 	}
 
-	var repoService distribution.Repository
+	var (
+		repoService distribution.Repository
+		registryURL string
+		rt          http.RoundTripper
+	)
+
 	for _, baseURL := range baseURLs {
 		glog.V(3).Infof("open registry %s", baseURL)
-		repoService, err = registryclient.NewRepository(repoName, baseURL, http.DefaultTransport)
+		if rt, err = newRegistryTransport(baseURL, repo, opts.Credentials); err != nil {
+			glog.V(3).Infof("connect to registry %s failed: %s", baseURL, err)
+			continue
+		}
+
+		repoService, err = registryclient.NewRepository(repoName, baseURL, rt)
 		if err != nil {
 			glog.V(3).Infof("open repository %s failed: %s", repoName, err)
 			continue
 		}
 
+		registryURL = baseURL
 		break
 	}
 
@@ -90,8 +193,39 @@ func PushDirectly(image, remote string) (err error) {
 		return
 	}
 
-	netCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	layers, err := imageLoader.GetLayers()
+	if err != nil {
+		glog.V(3).Infof("read local layers failed: %s", err)
+		return
+	}
+
+	tty := opts.Progress == ProgressTTY
+	if opts.Progress == ProgressAuto {
+		_, tty = term.GetFdInfo(os.Stdout)
+	}
+
+	progress := newPushProgress(os.Stdout, tty, opts.Quiet)
+	defer progress.Stop()
+	// Layers are compressed by upload workers, so that uploading a layer overlaps compressing others.
+	for _, layer := range layers {
+		progress.Add(layer.ID())
+		progress.SetStatus(layer.ID(), "Waiting")
+	}
+
+	// Uploads are canceled and their sessions are removed on Ctrl-C.
+	netCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "canceling uploads")
+			cancel()
+		case <-netCtx.Done():
+		}
+	}()
 
 	maniService, err := repoService.Manifests(netCtx)
 	if err != nil {
@@ -100,40 +234,14 @@ func PushDirectly(image, remote string) (err error) {
 	}
 
 	blobStore := repoService.Blobs(netCtx)
-
-	layers, err := imageLoader.GetLayers()
+	uploader, err := newBlobUploader(rt, registryURL, repo, blobStore, opts, progress)
 	if err != nil {
-		glog.V(3).Infof("read local layers failed: %s", err)
 		return
 	}
 
-	for _, layer := range layers {
-		if _, err = blobStore.Stat(netCtx, layer.descriptor.Digest); err != nil {
-			var bw distribution.BlobWriter
-			if bw, err = blobStore.Create(netCtx); err != nil {
-				glog.V(3).Infof("create blobs failed: %s", err)
-				return
-			}
-
-			var reader io.ReadCloser
-			if reader, err = layer.OpenReader(); err != nil {
-				glog.V(3).Infof("read local layers failed: %s", err)
-				return
-			}
-
-			if _, err = bw.ReadFrom(reader); err != nil {
-				glog.V(3).Infof("upload blobs failed: %s", err)
-				reader.Close()
-				return
-			}
-
-			reader.Close()
-
-			if _, err = bw.Commit(netCtx, layer.descriptor); err != nil {
-				glog.V(3).Infof("commit blobs failed: %s", err)
-				return
-			}
-		}
+	if err = uploader.UploadAll(netCtx, layers); err != nil {
+		glog.V(3).Infof("upload blobs failed: %s", err)
+		return
 	}
 
 	manifests, err := imageLoader.GetManifests()
@@ -142,33 +250,43 @@ func PushDirectly(image, remote string) (err error) {
 		return
 	}
 
-	for _, m := range manifests {
-		dgst, err := digest.Parse(m.conf.Config.Image)
-		if err != nil {
-			glog.V(3).Infof("read local manifest digest failed: %s", err)
-			return err
-		}
+	// The number of manifests is checked by PushDirectly.
+	m := manifests[0]
+	var builder distribution.ManifestBuilder
+	if opts.Compression == CompressionZstd {
+		// zstd layers are only allowed in OCI manifests.
+		builder = ocischema.NewManifestBuilder(blobStore, m.rawConf, nil)
+	} else {
+		builder = schema2.NewManifestBuilder(blobStore, schema2.MediaTypeImageConfig, m.rawConf)
+	}
 
-		if existed, _ := maniService.Exists(netCtx, dgst); existed {
-			glog.V(3).Infof("ignore existed manifest %s", dgst)
-			continue
+	for _, layer := range m.layers {
+		if err = builder.AppendReference(layer); err != nil {
+			return
 		}
+	}
 
-		builder := schema2.NewManifestBuilder(blobStore, schema2.MediaTypeManifest, m.rawConf)
-		manifest, err := builder.Build(netCtx)
-		if err != nil {
-			glog.V(3).Infof("build local manifest failed: %s", err)
-			return err
-		}
+	manifestCtx, cancelManifest := context.WithTimeout(netCtx, opts.BlobTimeout)
+	defer cancelManifest()
 
-		newDgst, err := maniService.Put(netCtx, manifest)
-		if err != nil {
-			glog.V(3).Infof("put manifest failed: %s", err)
-			return err
-		}
+	// The configuration blob is pushed while building.
+	manifest, err := builder.Build(manifestCtx)
+	if err != nil {
+		glog.V(3).Infof("build local manifest failed: %s", err)
+		return
+	}
 
-		fmt.Println("Digest of the new image is", newDgst.String())
+	_, payload, err := manifest.Payload()
+	if err != nil {
+		return
+	}
+
+	dgst, err := maniService.Put(manifestCtx, manifest, distribution.WithTag(tag))
+	if err != nil {
+		glog.V(3).Infof("put manifest failed: %s", err)
+		return
 	}
 
+	progress.Summary(tag, dgst.String(), len(payload))
 	return
 }
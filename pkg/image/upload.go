@@ -0,0 +1,377 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/distribution"
+	"github.com/golang/glog"
+	"github.com/opencontainers/go-digest"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultParallelism = 5
+	DefaultChunkSize   = 16 << 20
+	DefaultRetries     = 5
+	DefaultBlobTimeout = 30 * time.Minute
+
+	minRetryInterval = time.Second
+	maxRetryInterval = 30 * time.Second
+	// cancelTimeout limits the time of removing upload sessions after pushing failed or interrupted.
+	cancelTimeout = 10 * time.Second
+)
+
+// uploadError is the error response of registries.
+type uploadError struct {
+	status  int
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return fmt.Sprintf("registry responses %d %s", e.status, e.message)
+}
+
+// sessionLost returns whether the upload session should be restarted, which is not found or rejects the offset.
+func sessionLost(err error) bool {
+	e, ok := err.(*uploadError)
+	return ok && (e.status == http.StatusNotFound || e.status == http.StatusRequestedRangeNotSatisfiable)
+}
+
+// retriable returns whether the error is caused by the network or a temporary failure of the registry.
+func retriable(err error) bool {
+	e, ok := err.(*uploadError)
+	if !ok {
+		return true
+	}
+
+	return e.status >= http.StatusInternalServerError || e.status == http.StatusRequestTimeout ||
+		e.status == http.StatusTooManyRequests || sessionLost(err)
+}
+
+// blobUploader uploads blobs in chunks through the docker registry API. A failed upload is resumed from the offset
+// the registry reported.
+type blobUploader struct {
+	client   *http.Client
+	baseURL  *url.URL
+	repo     string
+	statter  distribution.BlobStatter
+	opts     *PushOptions
+	progress *pushProgress
+}
+
+func newBlobUploader(rt http.RoundTripper, baseURL, repo string, statter distribution.BlobStatter,
+	opts *PushOptions, progress *pushProgress) (u *blobUploader, err error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return
+	}
+
+	u = &blobUploader{
+		client:   &http.Client{Transport: rt},
+		baseURL:  base,
+		repo:     repo,
+		statter:  statter,
+		opts:     opts,
+		progress: progress,
+	}
+
+	return
+}
+
+// UploadAll uploads layers concurrently. Other uploads are canceled once one fails.
+func (u *blobUploader) UploadAll(ctx context.Context, layers []*layerLoader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan *layerLoader, len(layers))
+	for _, layer := range layers {
+		queue <- layer
+	}
+
+	close(queue)
+
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		firstErr error
+	)
+
+	for i := 0; i < u.opts.Parallelism && i < len(layers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for layer := range queue {
+				if err := u.Upload(ctx, layer); err != nil {
+					lock.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+
+					lock.Unlock()
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// Upload compresses the layer then uploads its blob if it doesn't exist in the registry. It is retried with
+// exponential backoff until the blob timeout.
+func (u *blobUploader) Upload(ctx context.Context, layer *layerLoader) (err error) {
+	if u.opts.Compression != CompressionNone {
+		glog.V(3).Infof("compress layer %s with %s", layer.descriptor.Digest, u.opts.Compression)
+		u.progress.SetStatus(layer.ID(), "Compressing")
+		if err = layer.Compress(u.opts.Compression, u.opts.CompressionLevel); err != nil {
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.opts.BlobTimeout)
+	defer cancel()
+
+	desc := layer.Descriptor()
+	if _, err = u.statter.Stat(ctx, desc.Digest); err == nil {
+		glog.V(3).Infof("blob %s already exists", desc.Digest)
+		u.progress.SetStatus(layer.ID(), "Layer already exists")
+		return
+	}
+
+	f, err := os.Open(layer.blobPath())
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	var location string
+	defer func() {
+		if err != nil && len(location) > 0 {
+			u.cancel(location)
+		}
+	}()
+
+	interval := minRetryInterval
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			glog.V(3).Infof("retry uploading blob %s in %s cuz %s", desc.Digest, interval, err)
+			u.progress.SetStatus(layer.ID(), fmt.Sprintf("Retrying in %s", interval))
+			select {
+			case <-ctx.Done():
+				err = fmt.Errorf("fail to upload blob %s cuz %s. the last error is %s", desc.Digest, ctx.Err(), err)
+				return
+			case <-time.After(interval):
+			}
+
+			if interval *= 2; interval > maxRetryInterval {
+				interval = maxRetryInterval
+			}
+		}
+
+		if location, err = u.tryUpload(ctx, f, layer.ID(), desc, location); err == nil {
+			u.progress.Finish(layer.ID())
+			return
+		}
+
+		if ctx.Err() != nil || !retriable(err) || attempt >= u.opts.Retries {
+			return
+		}
+
+		if sessionLost(err) && len(location) > 0 {
+			u.cancel(location)
+			location = ""
+		}
+	}
+}
+
+// tryUpload starts an upload session, or resumes the session at location from the offset the registry has
+// received, then uploads the rest of the blob in chunks. The session is returned if the upload is not finished.
+func (u *blobUploader) tryUpload(ctx context.Context, f io.ReaderAt, id string, desc distribution.Descriptor,
+	location string) (newLocation string, err error) {
+	var offset int64
+	if len(location) == 0 {
+		if location, err = u.start(ctx); err != nil {
+			return
+		}
+	} else {
+		// The session is kept to be resumed or canceled later unless the registry has lost it.
+		var resumed string
+		if resumed, offset, err = u.status(ctx, location); err != nil {
+			return location, err
+		}
+
+		location = resumed
+	}
+
+	u.progress.Start(id, offset, desc.Size)
+	for offset < desc.Size {
+		size := desc.Size - offset
+		if size > u.opts.ChunkSize {
+			size = u.opts.ChunkSize
+		}
+
+		var next string
+		chunk := &progressReader{Reader: io.NewSectionReader(f, offset, size), id: id, progress: u.progress}
+		if next, offset, err = u.patch(ctx, location, chunk, offset, size); err != nil {
+			return location, err
+		}
+
+		location = next
+	}
+
+	if err = u.finish(ctx, location, desc.Digest); err != nil {
+		return location, err
+	}
+
+	return "", nil
+}
+
+func (u *blobUploader) start(ctx context.Context) (location string, err error) {
+	resp, err := u.do(ctx, http.MethodPost, u.uploadURL(), nil, 0, nil)
+	if err != nil {
+		return
+	}
+
+	return u.location(resp)
+}
+
+// status returns the offset the registry has received.
+func (u *blobUploader) status(ctx context.Context, location string) (newLocation string, offset int64, err error) {
+	resp, err := u.do(ctx, http.MethodGet, location, nil, 0, nil)
+	if err != nil {
+		return
+	}
+
+	if newLocation, err = u.location(resp); err != nil {
+		return
+	}
+
+	offset, err = parseRange(resp.Header.Get("Range"))
+	return
+}
+
+func (u *blobUploader) patch(ctx context.Context, location string, chunk io.Reader, offset, size int64) (
+	newLocation string, newOffset int64, err error) {
+	header := http.Header{}
+	header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+size-1))
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err := u.do(ctx, http.MethodPatch, location, chunk, size, header)
+	if err != nil {
+		return
+	}
+
+	if newLocation, err = u.location(resp); err != nil {
+		return
+	}
+
+	newOffset, err = parseRange(resp.Header.Get("Range"))
+	return
+}
+
+func (u *blobUploader) finish(ctx context.Context, location string, dgst digest.Digest) (err error) {
+	finishURL, err := url.Parse(location)
+	if err != nil {
+		return
+	}
+
+	query := finishURL.Query()
+	query.Set("digest", dgst.String())
+	finishURL.RawQuery = query.Encode()
+	_, err = u.do(ctx, http.MethodPut, finishURL.String(), nil, 0, nil)
+	return
+}
+
+// cancel removes the upload session. It works even if the push is interrupted.
+func (u *blobUploader) cancel(location string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	if _, err := u.do(ctx, http.MethodDelete, location, nil, 0, nil); err != nil {
+		glog.V(3).Infof("fail to cancel upload %s: %s", location, err)
+	}
+}
+
+func (u *blobUploader) uploadURL() string {
+	return u.baseURL.String() + "/v2/" + u.repo + "/blobs/uploads/"
+}
+
+// location returns the absolute URL of the upload session in the response.
+func (u *blobUploader) location(resp *http.Response) (string, error) {
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", err
+	}
+
+	if len(location.String()) == 0 {
+		return "", fmt.Errorf("no upload location found in response of %s", resp.Request.URL)
+	}
+
+	return u.baseURL.ResolveReference(location).String(), nil
+}
+
+func (u *blobUploader) do(ctx context.Context, method, url string, body io.Reader, size int64, header http.Header) (
+	resp *http.Response, err error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	resp, err = u.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		err = &uploadError{status: resp.StatusCode, message: strings.TrimSpace(string(message))}
+		return
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+	return
+}
+
+// parseRange returns the offset next to the range like 0-1023 the registry received. Registries report 0-0 if
+// nothing received.
+func parseRange(rng string) (offset int64, err error) {
+	if len(rng) == 0 {
+		return
+	}
+
+	parts := strings.SplitN(rng, "-", 2)
+	if len(parts) != 2 {
+		err = fmt.Errorf("bad range format: %s", rng)
+		return
+	}
+
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("bad range format: %s", rng)
+		return
+	}
+
+	if end > 0 {
+		offset = end + 1
+	}
+
+	return
+}
@@ -0,0 +1,56 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTryUploadKeepsSessionIfStatusFails(t *testing.T) {
+	blob := []byte("layer")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+
+	defer server.Close()
+
+	opts := &PushOptions{ChunkSize: DefaultChunkSize}
+	u, err := newBlobUploader(http.DefaultTransport, server.URL, "app", nil, opts,
+		newPushProgress(ioutil.Discard, false, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	location := server.URL + "/v2/app/blobs/uploads/1"
+	desc := distribution.Descriptor{Digest: digest.FromBytes(blob), Size: int64(len(blob))}
+	newLocation, err := u.tryUpload(context.Background(), bytes.NewReader(blob), "1", desc, location)
+	if err == nil {
+		t.Fatal("the upload should fail")
+	}
+
+	if newLocation != location {
+		t.Errorf("expected session %s kept, but got %q", location, newLocation)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for rng, expected := range map[string]int64{"": 0, "0-0": 0, "0-1023": 1024} {
+		offset, err := parseRange(rng)
+		if err != nil {
+			t.Errorf("fail to parse range %q: %s", rng, err)
+		}
+
+		if offset != expected {
+			t.Errorf("expected offset %d of range %q, but got %d", expected, rng, offset)
+		}
+	}
+
+	if _, err := parseRange("bytes"); err == nil {
+		t.Errorf("bad range is parsed")
+	}
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 )
 
 func SliceEqual(a, b []string) bool {
@@ -44,7 +46,51 @@ func WriteYaml(file string, obj interface{}) (err error) {
 		return
 	}
 
-	return ioutil.WriteFile(file, bin, 0644)
+	return WriteFileAtomically(file, bin, 0644)
+}
+
+// WritePrivateYaml writes obj to file which only the owner can read and write, since it may contain secrets.
+func WritePrivateYaml(file string, obj interface{}) (err error) {
+	bin, err := yaml.Marshal(obj)
+	if err != nil {
+		return
+	}
+
+	return WriteFileAtomically(file, bin, 0600)
+}
+
+// WriteFileAtomically writes data to a temporary file in the same directory then renames it to file, so that
+// readers never see a partially written file.
+func WriteFileAtomically(file string, data []byte, perm os.FileMode) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp")
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+
+	if err = tmp.Chmod(perm); err != nil {
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	return os.Rename(tmp.Name(), file)
 }
 
 func ReadYaml(file string, obj interface{}) (err error) {
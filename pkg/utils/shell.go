@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+)
+
+// ShellQuote quotes s in single quotes if it contains any character having special meaning in POSIX shells, so
+// that the shell reads s back as a single word.
+func ShellQuote(s string) string {
+	if len(s) == 0 {
+		return `''`
+	}
+
+	safe := true
+	for _, r := range s {
+		if !isShellSafe(r) {
+			safe = false
+			break
+		}
+	}
+
+	if safe {
+		return s
+	}
+
+	return `'` + strings.Replace(s, `'`, `'\''`, -1) + `'`
+}
+
+func isShellSafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	}
+
+	return strings.ContainsRune(`@%+=:,./-_`, r)
+}
+
+// SystemdQuote quotes s for command lines in systemd unit files. Specifiers and environment variables are escaped
+// so that systemd passes s as is.
+func SystemdQuote(s string) string {
+	s = strings.Replace(s, `%`, `%%`, -1)
+	s = strings.Replace(s, `$`, `$$`, -1)
+	if len(s) > 0 && strings.IndexFunc(s, func(r rune) bool { return !isShellSafe(r) && r != '$' }) < 0 {
+		return s
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + replacer.Replace(s) + `"`
+}
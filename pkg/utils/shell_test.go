@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"github.com/mattn/go-shellwords"
+	"strings"
+	"testing"
+)
+
+var quoteCases = []string{
+	``,
+	`nginx:1.17`,
+	`a b`,
+	`it's`,
+	`'quoted'`,
+	`"double" quotes`,
+	`$HOME`,
+	`${PATH}:/opt/bin`,
+	"`id`",
+	`$(id)`,
+	"line 1\nline 2",
+	"tab\there",
+	`back\slash`,
+	`a;b&&c|d>e<f`,
+	`*.go ?`,
+	`~/data`,
+	`#comment`,
+	`100%`,
+	`日本語`,
+	`naïve café`,
+}
+
+func TestShellQuoteRoundTrip(t *testing.T) {
+	for _, s := range quoteCases {
+		quoted := ShellQuote(s)
+		words, err := shellwords.Parse(quoted)
+		if err != nil {
+			t.Errorf("fail to parse %q quoted from %q: %s", quoted, s, err)
+			continue
+		}
+
+		if len(s) == 0 {
+			// go-shellwords drops empty words, while shells read '' as an empty argument.
+			if quoted != `''` {
+				t.Errorf("empty string is quoted to %q", quoted)
+			}
+
+			continue
+		}
+
+		if len(words) != 1 || words[0] != s {
+			t.Errorf("%q is quoted to %q, which is parsed back to %q", s, quoted, words)
+		}
+	}
+}
+
+func TestShellQuoteCommandRoundTrip(t *testing.T) {
+	var quoted []string
+	for _, s := range quoteCases[1:] {
+		quoted = append(quoted, ShellQuote(s))
+	}
+
+	words, err := shellwords.Parse(strings.Join(quoted, ` `))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(words) != len(quoteCases)-1 {
+		t.Fatalf("expected %d words, but got %q", len(quoteCases)-1, words)
+	}
+
+	for i, w := range words {
+		if w != quoteCases[i+1] {
+			t.Errorf("expected %q, but got %q", quoteCases[i+1], w)
+		}
+	}
+}
+
+func TestShellQuoteSafeWords(t *testing.T) {
+	for _, s := range []string{`nginx:1.17`, `--env`, `A=1`, `/var/lib/docker`, `user@host`, `a,b`} {
+		if quoted := ShellQuote(s); quoted != s {
+			t.Errorf("%q shouldn't be quoted but got %q", s, quoted)
+		}
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	cases := []struct {
+		s      string
+		quoted string
+	}{
+		{``, `""`},
+		{`nginx:1.17`, `nginx:1.17`},
+		{`a b`, `"a b"`},
+		{`it's`, `"it's"`},
+		{`"double" quotes`, `"\"double\" quotes"`},
+		{`$HOME`, `$$HOME`},
+		{`${PATH}`, `"$${PATH}"`},
+		{`100%`, `100%%`},
+		{"`id`", "\"`id`\""},
+		{"line 1\nline 2", `"line 1\nline 2"`},
+		{"tab\there", `"tab\there"`},
+		{`back\slash`, `"back\\slash"`},
+		{`日本語`, `"日本語"`},
+	}
+
+	for _, c := range cases {
+		if quoted := SystemdQuote(c.s); quoted != c.quoted {
+			t.Errorf("expected %q quoted to %q, but got %q", c.s, c.quoted, quoted)
+		}
+	}
+}
+
+// TestSystemdQuoteRoundTrip parses quoted words like systemd does for strings without control characters, whose
+// quoting rules are the same as shells once specifiers and variables are unescaped.
+func TestSystemdQuoteRoundTrip(t *testing.T) {
+	unescape := strings.NewReplacer(`%%`, `%`, `$$`, `$`)
+	for _, s := range quoteCases {
+		if len(s) == 0 || strings.ContainsAny(s, "\n\t") {
+			continue
+		}
+
+		quoted := SystemdQuote(s)
+		words, err := shellwords.Parse(unescape.Replace(quoted))
+		if err != nil {
+			t.Errorf("fail to parse %q quoted from %q: %s", quoted, s, err)
+			continue
+		}
+
+		if len(words) != 1 || words[0] != s {
+			t.Errorf("%q is quoted to %q, which is parsed back to %q", s, quoted, words)
+		}
+	}
+}